@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// aggregator reduces the values of an interval bucket to a single value.
+type aggregator func(values []float64) float64
+
+// aggregators by the name used in the query model.
+var aggregators = map[string]aggregator{
+	"avg":    aggregateAvg,
+	"min":    aggregateMin,
+	"max":    aggregateMax,
+	"median": percentileAggregator(50),
+	"p95":    percentileAggregator(95),
+	"p99":    percentileAggregator(99),
+	"count":  aggregateCount,
+}
+
+// getAggregator returns the aggregator of the query model, nil if the
+// results are not aggregated.
+func getAggregator(name string) (aggregator, error) {
+	if name == "" || name == "none" {
+		return nil, nil
+	}
+
+	agg, ok := aggregators[name]
+	if !ok {
+		return nil, fmt.Errorf("invalid aggregation: '%s'", name)
+	}
+
+	return agg, nil
+}
+
+// aggregationInterval returns the interval of the buckets, which is the query
+// interval or larger if needed to stay within MaxDataPoints.
+func aggregationInterval(query *backend.DataQuery) time.Duration {
+	interval := query.Interval
+
+	if query.MaxDataPoints > 0 {
+		minInterval := query.TimeRange.To.Sub(query.TimeRange.From) / time.Duration(query.MaxDataPoints)
+		if minInterval > interval {
+			interval = minInterval
+		}
+	}
+
+	// Results have a resolution of seconds
+	interval = interval.Round(time.Second)
+	if interval < time.Second {
+		interval = time.Second
+	}
+
+	return interval
+}
+
+// maxSeriesIntervals is the maximum number of intervals of series computed for
+// every interval of the range, which don't get fewer with fewer results.
+const maxSeriesIntervals = 1000
+
+// seriesInterval returns the aggregation interval, increased to at most
+// maxSeriesIntervals intervals in the range. Queries without MaxDataPoints,
+// e.g. of alert rules, would otherwise get an interval per second.
+func seriesInterval(query *backend.DataQuery) time.Duration {
+	interval := aggregationInterval(query)
+
+	minInterval := query.TimeRange.To.Sub(query.TimeRange.From) / maxSeriesIntervals
+	if minInterval > interval {
+		// Round up to seconds to stay within the maximum
+		interval = minInterval.Truncate(time.Second)
+		if interval < minInterval {
+			interval += time.Second
+		}
+	}
+
+	return interval
+}
+
+// aggregateSeries aggregates the values into buckets of interval length. The
+// time of a bucket is its start, buckets without values are omitted.
+func aggregateSeries(times []time.Time, values []int32, interval time.Duration, agg aggregator) ([]time.Time, []float64) {
+	buckets := make(map[int64][]float64)
+
+	for i, t := range times {
+		start := t.Truncate(interval).UnixNano()
+		buckets[start] = append(buckets[start], float64(values[i]))
+	}
+
+	starts := make([]int64, 0, len(buckets))
+	for start := range buckets {
+		starts = append(starts, start)
+	}
+
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+
+	bucketTimes := make([]time.Time, len(starts))
+	bucketValues := make([]float64, len(starts))
+
+	for i, start := range starts {
+		bucketTimes[i] = time.Unix(0, start).UTC()
+		bucketValues[i] = agg(buckets[start])
+	}
+
+	return bucketTimes, bucketValues
+}
+
+func aggregateAvg(values []float64) float64 {
+	sum := 0.0
+
+	for _, v := range values {
+		sum += v
+	}
+
+	return sum / float64(len(values))
+}
+
+func aggregateMin(values []float64) float64 {
+	m := math.Inf(1)
+
+	for _, v := range values {
+		m = math.Min(m, v)
+	}
+
+	return m
+}
+
+func aggregateMax(values []float64) float64 {
+	m := math.Inf(-1)
+
+	for _, v := range values {
+		m = math.Max(m, v)
+	}
+
+	return m
+}
+
+func aggregateCount(values []float64) float64 {
+	return float64(len(values))
+}
+
+// percentileAggregator returns an aggregator of the p-th percentile,
+// interpolating linearly between the closest ranks.
+func percentileAggregator(p float64) aggregator {
+	return func(values []float64) float64 {
+		sorted := append([]float64(nil), values...)
+		sort.Float64s(sorted)
+
+		rank := p / 100 * float64(len(sorted)-1)
+		lower := int(math.Floor(rank))
+		upper := int(math.Ceil(rank))
+
+		return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// alarmSeriesKey identifies the alarm count series of a monitor and alarm type.
+type alarmSeriesKey struct {
+	monitorID string
+	alarmType string
+}
+
+// queryAlarmCounts returns per monitor and alarm type the number of alarms
+// found per interval and the number of alarms open during the interval, and
+// the same counts over all selected alarms, as time series for alerting.
+func (td *WebMonitoringDatasource) queryAlarmCounts(ctx context.Context, inst *instanceSettings, query *backend.DataQuery,
+	qm *queryModel, apiToken string) backend.DataResponse {
+	response := backend.DataResponse{}
+
+	monitorsMap, selected, err := inst.alarmMonitors(ctx, qm, apiToken)
+	if err != nil {
+		response.Error = err
+
+		return response
+	}
+
+	alarms, err := inst.getAlarms(ctx, apiToken, query.TimeRange.From.UTC(), query.TimeRange.To.UTC())
+	if err != nil {
+		log.DefaultLogger.Error("getAlarms: ", err.Error())
+
+		response.Error = fmt.Errorf("get alarms failed: %w", err)
+
+		return response
+	}
+
+	series := make(map[alarmSeriesKey][]alarm)
+	all := make([]alarm, 0, len(alarms))
+
+	for idx := range alarms {
+		if !alarmSelected(qm, selected, &alarms[idx]) {
+			continue
+		}
+
+		key := alarmSeriesKey{monitorID: alarms[idx].MonitorID, alarmType: alarms[idx].AlarmType}
+		series[key] = append(series[key], alarms[idx])
+		all = append(all, alarms[idx])
+	}
+
+	keys := make([]alarmSeriesKey, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		ni, nj := monitorName(monitorsMap, keys[i].monitorID), monitorName(monitorsMap, keys[j].monitorID)
+		if ni != nj {
+			return ni < nj
+		}
+
+		if keys[i].monitorID != keys[j].monitorID {
+			return keys[i].monitorID < keys[j].monitorID
+		}
+
+		return keys[i].alarmType < keys[j].alarmType
+	})
+
+	interval := seriesInterval(query)
+
+	end := time.Now()
+	if end.After(query.TimeRange.To) {
+		end = query.TimeRange.To
+	}
+
+	for _, key := range keys {
+		m := monitor{MonitorID: key.monitorID, Name: monitorName(monitorsMap, key.monitorID)}
+
+		labels := monitorLabels(&m)
+		labels["alarm_type"] = key.alarmType
+
+		response.Frames = append(response.Frames, alarmCountFrame(m.Name+" - "+key.alarmType, labels, series[key],
+			query.TimeRange.From, query.TimeRange.To, end, interval))
+	}
+
+	response.Frames = append(response.Frames, alarmCountFrame("All monitors", nil, all,
+		query.TimeRange.From, query.TimeRange.To, end, interval))
+
+	return response
+}
+
+// alarmCountFrame returns the number of alarms found per interval and the
+// maximum number of alarms open at the same time during the interval, open
+// alarms last until end. Every interval of the range has a value so alert
+// rules see zero counts.
+func alarmCountFrame(name string, labels data.Labels, alarms []alarm, from, to, end time.Time,
+	interval time.Duration) *data.Frame {
+	var times []time.Time
+
+	var opened, open []int64
+
+	found := make([]time.Time, 0, len(alarms))
+	for idx := range alarms {
+		found = append(found, alarms[idx].FoundAt)
+	}
+
+	sort.Slice(found, func(i, j int) bool { return found[i].Before(found[j]) })
+
+	events := alarmEvents(alarms, end)
+
+	// The found times and events are swept once across the intervals, the
+	// alarms found at or before the start of an interval are open during it
+	var openCount int64
+
+	nextFound, next := 0, 0
+
+	for start := from.Truncate(interval); start.Before(to); start = start.Add(interval) {
+		bucketEnd := start.Add(interval)
+
+		var openedCount int64
+
+		for ; nextFound < len(found) && found[nextFound].Before(bucketEnd); nextFound++ {
+			if !found[nextFound].Before(start) {
+				openedCount++
+			}
+		}
+
+		for ; next < len(events) && !events[next].at.After(start); next++ {
+			openCount += events[next].delta
+		}
+
+		maxOpen := openCount
+
+		for ; next < len(events) && events[next].at.Before(bucketEnd); next++ {
+			openCount += events[next].delta
+
+			if openCount > maxOpen {
+				maxOpen = openCount
+			}
+		}
+
+		times = append(times, start.UTC())
+		opened = append(opened, openedCount)
+		open = append(open, maxOpen)
+	}
+
+	return data.NewFrame(name,
+		data.NewField("time", nil, times),
+		data.NewField("opened", labels, opened).SetConfig(&data.FieldConfig{DisplayNameFromDS: name + " opened"}),
+		data.NewField("open", labels, open).SetConfig(&data.FieldConfig{DisplayNameFromDS: name + " open"}),
+	)
+}
+
+// alarmEvent is an alarm being found (+1) or resolved (-1).
+type alarmEvent struct {
+	at    time.Time
+	delta int64
+}
+
+// alarmEvents returns the events of the alarms sorted by time, open alarms are
+// resolved at end. Alarms resolved at the time another one is found don't
+// overlap, so resolving sorts first.
+func alarmEvents(alarms []alarm, end time.Time) []alarmEvent {
+	events := make([]alarmEvent, 0, 2*len(alarms))
+
+	for idx := range alarms {
+		a := &alarms[idx]
+
+		resolved := a.ResolvedAt
+		if resolved.IsZero() {
+			resolved = end
+		}
+
+		if !resolved.After(a.FoundAt) {
+			continue
+		}
+
+		events = append(events, alarmEvent{at: a.FoundAt, delta: 1}, alarmEvent{at: resolved, delta: -1})
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		if !events[i].at.Equal(events[j].at) {
+			return events[i].at.Before(events[j].at)
+		}
+
+		return events[i].delta < events[j].delta
+	})
+
+	return events
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestAlarmCountFrame(t *testing.T) {
+	base := time.Date(2021, 7, 1, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return base.Add(time.Duration(minutes) * time.Minute) }
+
+	backToBack := make([]alarm, 0, 10)
+	for i := 0; i < 10; i++ {
+		backToBack = append(backToBack, alarm{MonitorID: "a", FoundAt: at(i), ResolvedAt: at(i + 1)})
+	}
+
+	overlapping := []alarm{
+		{MonitorID: "a", FoundAt: at(-5), ResolvedAt: at(3)},
+		{MonitorID: "b", FoundAt: at(1), ResolvedAt: at(4)},
+		{MonitorID: "c", FoundAt: at(2)},
+		{MonitorID: "d", FoundAt: at(5), ResolvedAt: at(6)},
+		{MonitorID: "e", FoundAt: at(7), ResolvedAt: at(7)},
+	}
+
+	tests := []struct {
+		name         string
+		alarms       []alarm
+		opened, open []int64
+	}{
+		{"back to back", backToBack, []int64{5, 5}, []int64{1, 1}},
+		{"overlapping", overlapping, []int64{2, 2}, []int64{3, 2}},
+		{"none", nil, []int64{0, 0}, []int64{0, 0}},
+	}
+
+	for _, tt := range tests {
+		frame := alarmCountFrame(tt.name, nil, tt.alarms, at(0), at(10), at(10), 5*time.Minute)
+
+		opened := make([]int64, frame.Rows())
+		open := make([]int64, frame.Rows())
+
+		for i := range opened {
+			opened[i] = frame.Fields[1].At(i).(int64)
+			open[i] = frame.Fields[2].At(i).(int64)
+		}
+
+		if !reflect.DeepEqual(opened, tt.opened) || !reflect.DeepEqual(open, tt.open) {
+			t.Errorf("%s: opened = %v, open = %v, want %v and %v", tt.name, opened, open, tt.opened, tt.open)
+		}
+	}
+}
+
+func TestSeriesInterval(t *testing.T) {
+	from := time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC)
+
+	query := &backend.DataQuery{
+		TimeRange: backend.TimeRange{From: from, To: from.AddDate(0, 0, 30)},
+		Interval:  time.Second,
+	}
+
+	interval := seriesInterval(query)
+	if n := query.TimeRange.To.Sub(query.TimeRange.From) / interval; n > maxSeriesIntervals {
+		t.Errorf("interval %s gives %d intervals, want at most %d", interval, n, maxSeriesIntervals)
+	}
+
+	// Larger query intervals are kept
+	query.Interval = 24 * time.Hour
+
+	if interval := seriesInterval(query); interval != 24*time.Hour {
+		t.Errorf("interval = %s, want 24h", interval)
+	}
+}
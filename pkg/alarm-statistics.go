@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// alarmStats are the statistics of the alarms of a time window. Alarms are
+// counted in the window they were found in, downtime counts the time any
+// alarm of a monitor was open within the window.
+type alarmStats struct {
+	count    int64
+	open     int64
+	mtta     *float64
+	mttr     *float64
+	longest  float64
+	downtime float64
+}
+
+// computeAlarmStats returns the statistics of the alarms of one or more
+// monitors in [from, to). Open alarms last until end.
+func computeAlarmStats(alarms []alarm, from, to, end time.Time) alarmStats {
+	var stats alarmStats
+
+	var ackSum, repairSum time.Duration
+
+	var ackCount, repairCount int64
+
+	outages := make(map[string][]timeWindow)
+
+	for idx := range alarms {
+		a := &alarms[idx]
+
+		resolved := a.ResolvedAt
+		if resolved.IsZero() {
+			resolved = end
+		}
+
+		outages[a.MonitorID] = append(outages[a.MonitorID], clipWindow(timeWindow{From: a.FoundAt, To: resolved}, from, to))
+
+		if a.FoundAt.Before(from) || !a.FoundAt.Before(to) {
+			continue
+		}
+
+		stats.count++
+
+		if a.ResolvedAt.IsZero() || !a.ResolvedAt.Before(to) {
+			stats.open++
+		}
+
+		if !a.AcknowledgedAt.IsZero() && !a.AcknowledgedAt.Before(a.FoundAt) {
+			ackSum += a.AcknowledgedAt.Sub(a.FoundAt)
+			ackCount++
+		}
+
+		if !a.ResolvedAt.IsZero() && !a.ResolvedAt.Before(a.FoundAt) {
+			repairSum += a.ResolvedAt.Sub(a.FoundAt)
+			repairCount++
+		}
+	}
+
+	if ackCount > 0 {
+		mtta := (ackSum / time.Duration(ackCount)).Seconds()
+		stats.mtta = &mtta
+	}
+
+	if repairCount > 0 {
+		mttr := (repairSum / time.Duration(repairCount)).Seconds()
+		stats.mttr = &mttr
+	}
+
+	// Overlapping alarms of a monitor are one outage
+	for _, windows := range outages {
+		for _, w := range mergeWindows(windows) {
+			d := w.To.Sub(w.From).Seconds()
+
+			stats.downtime += d
+
+			if d > stats.longest {
+				stats.longest = d
+			}
+		}
+	}
+
+	return stats
+}
+
+// queryAlarmStatistics returns the alarm count, open alarms, mean time to
+// acknowledge and resolve, the longest outage and the total downtime per
+// monitor and overall, for the range as a table or per interval as time series.
+func (td *WebMonitoringDatasource) queryAlarmStatistics(ctx context.Context, inst *instanceSettings,
+	query *backend.DataQuery, qm *queryModel, apiToken string) backend.DataResponse {
+	response := backend.DataResponse{}
+
+	monitorsMap, selected, err := inst.alarmMonitors(ctx, qm, apiToken)
+	if err != nil {
+		response.Error = err
+
+		return response
+	}
+
+	alarms, err := inst.getAlarms(ctx, apiToken, query.TimeRange.From.UTC(), query.TimeRange.To.UTC())
+	if err != nil {
+		log.DefaultLogger.Error("getAlarms: ", err.Error())
+
+		response.Error = fmt.Errorf("get alarms failed: %w", err)
+
+		return response
+	}
+
+	byMonitor := make(map[string][]alarm)
+	all := make([]alarm, 0, len(alarms))
+
+	for idx := range alarms {
+		if !alarmSelected(qm, selected, &alarms[idx]) {
+			continue
+		}
+
+		byMonitor[alarms[idx].MonitorID] = append(byMonitor[alarms[idx].MonitorID], alarms[idx])
+		all = append(all, alarms[idx])
+	}
+
+	monitors := make([]monitor, 0, len(byMonitor))
+
+	for monitorID := range byMonitor {
+		monitors = append(monitors, monitor{MonitorID: monitorID, Name: monitorName(monitorsMap, monitorID)})
+	}
+
+	sort.Slice(monitors, func(i, j int) bool {
+		if monitors[i].Name != monitors[j].Name {
+			return monitors[i].Name < monitors[j].Name
+		}
+
+		return monitors[i].MonitorID < monitors[j].MonitorID
+	})
+
+	from, to := query.TimeRange.From, query.TimeRange.To
+
+	end := time.Now()
+	if end.After(to) {
+		end = to
+	}
+
+	if !qm.PerInterval {
+		frame := alarmStatsTable()
+
+		for i := range monitors {
+			appendAlarmStatsRow(frame, monitors[i].Name, computeAlarmStats(byMonitor[monitors[i].MonitorID], from, to, end))
+		}
+
+		appendAlarmStatsRow(frame, "Overall", computeAlarmStats(all, from, to, end))
+
+		response.Frames = append(response.Frames, frame)
+
+		return response
+	}
+
+	interval := seriesInterval(query)
+
+	for i := range monitors {
+		response.Frames = append(response.Frames, alarmStatsSeries(monitors[i].Name, monitorLabels(&monitors[i]),
+			byMonitor[monitors[i].MonitorID], from, to, end, interval))
+	}
+
+	response.Frames = append(response.Frames, alarmStatsSeries("Overall", data.Labels{"monitor_name": "Overall"},
+		all, from, to, end, interval))
+
+	return response
+}
+
+func alarmStatsTable() *data.Frame {
+	seconds := func() *data.FieldConfig { return &data.FieldConfig{Unit: "s"} }
+
+	return data.NewFrame("alarm statistics",
+		data.NewField("Monitor", nil, []string{}),
+		data.NewField("Alarms", nil, []int64{}),
+		data.NewField("Open", nil, []int64{}),
+		data.NewField("MTTA", nil, []*float64{}).SetConfig(seconds()),
+		data.NewField("MTTR", nil, []*float64{}).SetConfig(seconds()),
+		data.NewField("Longest Outage", nil, []float64{}).SetConfig(seconds()),
+		data.NewField("Downtime", nil, []float64{}).SetConfig(seconds()),
+	)
+}
+
+func appendAlarmStatsRow(frame *data.Frame, name string, stats alarmStats) {
+	frame.AppendRow(name, stats.count, stats.open, stats.mtta, stats.mttr, stats.longest, stats.downtime)
+}
+
+// alarmStatsSeries returns the statistics of the alarms per interval, every
+// interval of the range has a value so alert rules see zero counts.
+func alarmStatsSeries(name string, labels data.Labels, alarms []alarm, from, to, end time.Time,
+	interval time.Duration) *data.Frame {
+	frame := data.NewFrame(name,
+		data.NewField("time", nil, []time.Time{}),
+		data.NewField("alarms", labels, []int64{}),
+		data.NewField("open", labels, []int64{}),
+		data.NewField("mtta", labels, []*float64{}).SetConfig(&data.FieldConfig{Unit: "s", DisplayNameFromDS: name + " MTTA"}),
+		data.NewField("mttr", labels, []*float64{}).SetConfig(&data.FieldConfig{Unit: "s", DisplayNameFromDS: name + " MTTR"}),
+		data.NewField("longest_outage", labels, []float64{}).SetConfig(&data.FieldConfig{
+			Unit: "s", DisplayNameFromDS: name + " Longest Outage",
+		}),
+		data.NewField("downtime", labels, []float64{}).SetConfig(&data.FieldConfig{
+			Unit: "s", DisplayNameFromDS: name + " Downtime",
+		}),
+	)
+
+	frame.Fields[1].SetConfig(&data.FieldConfig{DisplayNameFromDS: name + " Alarms"})
+	frame.Fields[2].SetConfig(&data.FieldConfig{DisplayNameFromDS: name + " Open"})
+
+	for start := from.Truncate(interval); start.Before(to); start = start.Add(interval) {
+		bucketEnd := start.Add(interval)
+
+		bucketOpenEnd := end
+		if bucketOpenEnd.After(bucketEnd) {
+			bucketOpenEnd = bucketEnd
+		}
+
+		stats := computeAlarmStats(alarms, start, bucketEnd, bucketOpenEnd)
+
+		frame.AppendRow(start.UTC(), stats.count, stats.open, stats.mtta, stats.mttr, stats.longest, stats.downtime)
+	}
+
+	return frame
+}
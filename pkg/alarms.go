@@ -0,0 +1,524 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// queryAlarms returns the selected alarms in the time range as a table,
+// sorted and limited as configured.
+func (td *WebMonitoringDatasource) queryAlarms(ctx context.Context, inst *instanceSettings, query *backend.DataQuery,
+	qm *queryModel, apiToken string) backend.DataResponse {
+	response := backend.DataResponse{}
+
+	monitorsMap, selected, err := inst.alarmMonitors(ctx, qm, apiToken)
+	if err != nil {
+		response.Error = err
+
+		return response
+	}
+
+	// Request alarms
+	alarms, err := inst.getAlarms(ctx, apiToken, query.TimeRange.From.UTC(), query.TimeRange.To.UTC())
+	if err != nil {
+		log.DefaultLogger.Error("getAlarms: ", err.Error())
+
+		response.Error = fmt.Errorf("get alarms failed: %w", err)
+
+		return response
+	}
+
+	log.DefaultLogger.Debug(fmt.Sprintf("Received %v alarms in total",
+		len(alarms)))
+
+	filtered := make([]alarm, 0, len(alarms))
+
+	for idx := range alarms {
+		if !alarmSelected(qm, selected, &alarms[idx]) {
+			continue
+		}
+
+		if _, ok := monitorsMap[alarms[idx].MonitorID]; !ok && !qm.KeepDeletedMonitors {
+			continue
+		}
+
+		filtered = append(filtered, alarms[idx])
+	}
+
+	alarms, err = sortAlarms(filtered, qm, monitorsMap)
+	if err != nil {
+		response.Error = err
+
+		return response
+	}
+
+	if qm.AlarmLimit > 0 && len(alarms) > qm.AlarmLimit {
+		alarms = alarms[:qm.AlarmLimit]
+	}
+
+	var monitorIDs, monitorNames, alarmStatus, alarmStates, alarmTypes []string
+
+	var foundAt, resolvedAt, acknowledgedAt []*time.Time
+
+	var durations []*float64
+
+	for idx := range alarms {
+		m := monitorName(monitorsMap, alarms[idx].MonitorID)
+
+		monitorIDs = append(monitorIDs, alarms[idx].MonitorID)
+		monitorNames = append(monitorNames, m)
+		alarmStatus = append(alarmStatus, alarms[idx].Status)
+		alarmStates = append(alarmStates, alarmState(&alarms[idx]))
+		alarmTypes = append(alarmTypes, alarms[idx].AlarmType)
+		foundAt = append(foundAt, nullableTime(alarms[idx].FoundAt))
+		resolvedAt = append(resolvedAt, nullableTime(alarms[idx].ResolvedAt))
+		acknowledgedAt = append(acknowledgedAt, nullableTime(alarms[idx].AcknowledgedAt))
+		durations = append(durations, alarmDurationSeconds(&alarms[idx]))
+	}
+
+	log.DefaultLogger.Debug(fmt.Sprintf("MonitorIDs: %v entries, %v",
+		len(monitorIDs), monitorIDs))
+	log.DefaultLogger.Debug(fmt.Sprintf("AlarmStatus: %v entries, %v",
+		len(alarmStatus), alarmStatus))
+	log.DefaultLogger.Debug(fmt.Sprintf("AlarmType: %v entries, %v",
+		len(alarmTypes), alarmTypes))
+
+	// create data frame response
+	frame := data.NewFrame("response")
+
+	frame.Fields = append(frame.Fields,
+		data.NewField("Monitor ID", nil, monitorIDs),
+		data.NewField("Monitor", nil, monitorNames),
+		data.NewField("Alarm Type", nil, alarmTypes),
+		data.NewField("Status", nil, alarmStatus),
+		data.NewField("State", nil, alarmStates),
+		data.NewField("Found", nil, foundAt),
+		data.NewField("Resolved", nil, resolvedAt),
+		data.NewField("Acknowledged", nil, acknowledgedAt),
+		data.NewField("Duration", nil, durations).SetConfig(&data.FieldConfig{Unit: "s"}))
+
+	// add the frames to the response
+	response.Frames = append(response.Frames, frame)
+
+	return response
+}
+
+// queryAlarmAnnotations returns the alarms of the selected monitors and alarm
+// types as annotations, regions from the time the alarm was found until it
+// was resolved or the end of the range if it is still open.
+func (td *WebMonitoringDatasource) queryAlarmAnnotations(ctx context.Context, inst *instanceSettings, query *backend.DataQuery,
+	qm *queryModel, apiToken string) backend.DataResponse {
+	response := backend.DataResponse{}
+
+	monitorsMap, selected, err := inst.alarmMonitors(ctx, qm, apiToken)
+	if err != nil {
+		response.Error = err
+
+		return response
+	}
+
+	alarms, err := inst.getAlarms(ctx, apiToken, query.TimeRange.From.UTC(), query.TimeRange.To.UTC())
+	if err != nil {
+		log.DefaultLogger.Error("getAlarms: ", err.Error())
+
+		response.Error = fmt.Errorf("get alarms failed: %w", err)
+
+		return response
+	}
+
+	sort.SliceStable(alarms, func(i, j int) bool { return alarms[i].FoundAt.Before(alarms[j].FoundAt) })
+
+	var times, timeEnds []time.Time
+
+	var texts, tags []string
+
+	for idx := range alarms {
+		a := &alarms[idx]
+
+		if !alarmSelected(qm, selected, a) {
+			continue
+		}
+
+		name := monitorName(monitorsMap, a.MonitorID)
+
+		end := a.ResolvedAt
+		if end.IsZero() || end.After(query.TimeRange.To) {
+			end = query.TimeRange.To
+		}
+
+		if end.Before(a.FoundAt) {
+			end = a.FoundAt
+		}
+
+		times = append(times, a.FoundAt)
+		timeEnds = append(timeEnds, end)
+		texts = append(texts, fmt.Sprintf("%s: %s (%s)", name, a.AlarmType, a.Status))
+		tags = append(tags, annotationTags(name, a.AlarmType))
+	}
+
+	frame := data.NewFrame("alarms",
+		data.NewField("time", nil, times),
+		data.NewField("timeEnd", nil, timeEnds),
+		data.NewField("text", nil, texts),
+		data.NewField("tags", nil, tags),
+	)
+
+	response.Frames = append(response.Frames, frame)
+
+	return response
+}
+
+// annotationTags returns the comma separated tags of an annotation. Grafana
+// splits the tags at commas, so commas within a tag are replaced by spaces.
+func annotationTags(tags ...string) string {
+	r := strings.NewReplacer(", ", " ", ",", " ")
+
+	for i, tag := range tags {
+		tags[i] = r.Replace(tag)
+	}
+
+	return strings.Join(tags, ",")
+}
+
+// alarmMonitors returns the monitor names by ID and the IDs of the monitors
+// the alarms are restricted to, nil if the query selects no monitors.
+func (s *instanceSettings) alarmMonitors(ctx context.Context, qm *queryModel,
+	apiToken string) (map[string]string, map[string]bool, error) {
+	monitors, err := s.getMonitors(ctx, apiToken)
+	if err != nil {
+		log.DefaultLogger.Error("get monitors failed: ", err.Error())
+
+		return nil, nil, fmt.Errorf("get monitors failed: %w", err)
+	}
+
+	monitorsMap := make(map[string]string)
+
+	for _, m := range monitors {
+		monitorsMap[m.MonitorID] = m.Name
+	}
+
+	if qm.MonitorID == "" && !qm.selectsMultipleMonitors() {
+		return monitorsMap, nil, nil
+	}
+
+	resolved, err := s.resolveMonitors(ctx, qm, apiToken)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	selected := make(map[string]bool)
+
+	for _, m := range resolved {
+		selected[m.MonitorID] = true
+	}
+
+	return monitorsMap, selected, nil
+}
+
+// Alarm states, derived from the acknowledged and resolved times.
+const (
+	alarmStateOpen         = "open"
+	alarmStateAcknowledged = "acknowledged"
+	alarmStateResolved     = "resolved"
+)
+
+// alarmState returns whether the alarm is open, acknowledged or resolved.
+func alarmState(a *alarm) string {
+	switch {
+	case !a.ResolvedAt.IsZero():
+		return alarmStateResolved
+	case !a.AcknowledgedAt.IsZero():
+		return alarmStateAcknowledged
+	}
+
+	return alarmStateOpen
+}
+
+// alarmSelected returns whether the alarm matches the monitor, alarm type,
+// state and minimum duration filters of the query.
+func alarmSelected(qm *queryModel, selected map[string]bool, a *alarm) bool {
+	if selected != nil && !selected[a.MonitorID] {
+		return false
+	}
+
+	if !alarmTypeSelected(qm.AlarmTypes, a.AlarmType) {
+		return false
+	}
+
+	if len(qm.AlarmStates) > 0 {
+		state := alarmState(a)
+		found := false
+
+		for _, s := range qm.AlarmStates {
+			if strings.EqualFold(strings.TrimSpace(s), state) {
+				found = true
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	if qm.MinAlarmDuration > 0 {
+		d := alarmDurationSeconds(a)
+		if d == nil || *d < qm.MinAlarmDuration {
+			return false
+		}
+	}
+
+	return true
+}
+
+// deletedMonitorName returns the placeholder name of a monitor which no
+// longer exists.
+func deletedMonitorName(monitorID string) string {
+	return fmt.Sprintf("Deleted monitor (%s)", monitorID)
+}
+
+// alarmSortKeys compare two alarms by a sort key of the query.
+var alarmSortKeys = map[string]func(a, b *alarm, names map[string]string) bool{
+	"found": func(a, b *alarm, _ map[string]string) bool { return a.FoundAt.Before(b.FoundAt) },
+	"resolved": func(a, b *alarm, _ map[string]string) bool {
+		return nullableTimeBefore(nullableTime(a.ResolvedAt), nullableTime(b.ResolvedAt))
+	},
+	"duration": func(a, b *alarm, _ map[string]string) bool {
+		da, db := alarmDurationSeconds(a), alarmDurationSeconds(b)
+		if da == nil || db == nil {
+			return da == nil && db != nil
+		}
+
+		return *da < *db
+	},
+	"monitor": func(a, b *alarm, names map[string]string) bool {
+		return monitorName(names, a.MonitorID) < monitorName(names, b.MonitorID)
+	},
+	"type": func(a, b *alarm, _ map[string]string) bool { return a.AlarmType < b.AlarmType },
+}
+
+// sortAlarms sorts the alarms by the sort key of the query, by default the
+// most recently found first.
+func sortAlarms(alarms []alarm, qm *queryModel, names map[string]string) ([]alarm, error) {
+	key := qm.AlarmSort
+	desc := qm.AlarmSortDesc
+
+	if key == "" {
+		key, desc = "found", true
+	}
+
+	less, ok := alarmSortKeys[key]
+	if !ok {
+		return nil, fmt.Errorf("unknown alarm sort '%s'", key)
+	}
+
+	sort.SliceStable(alarms, func(i, j int) bool {
+		if desc {
+			return less(&alarms[j], &alarms[i], names)
+		}
+
+		return less(&alarms[i], &alarms[j], names)
+	})
+
+	return alarms, nil
+}
+
+func monitorName(names map[string]string, monitorID string) string {
+	if name, ok := names[monitorID]; ok {
+		return name
+	}
+
+	return deletedMonitorName(monitorID)
+}
+
+// nullableTimeBefore orders unset times first.
+func nullableTimeBefore(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == nil && b != nil
+	}
+
+	return a.Before(*b)
+}
+
+// alarmTypeSelected returns whether the alarm type is one of the selected
+// alarm types. No selected alarm types select all alarms.
+func alarmTypeSelected(alarmTypes []string, alarmType string) bool {
+	if len(alarmTypes) == 0 {
+		return true
+	}
+
+	for _, t := range alarmTypes {
+		if strings.EqualFold(strings.TrimSpace(t), alarmType) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// nullableTime returns nil for the zero time, which the API uses for unset times.
+func nullableTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
+
+// alarmDurationSeconds returns the duration of the alarm in seconds, from the
+// API duration or else the resolved alarm's found and resolved times, nil if
+// neither is known.
+func alarmDurationSeconds(a *alarm) *float64 {
+	d, err := parseAlarmDuration(a.Duration)
+	if err != nil {
+		if a.Duration != "" {
+			log.DefaultLogger.Debug(fmt.Sprintf("Invalid alarm duration '%s': %v", a.Duration, err))
+		}
+
+		if a.FoundAt.IsZero() || a.ResolvedAt.IsZero() {
+			return nil
+		}
+
+		d = a.ResolvedAt.Sub(a.FoundAt)
+	}
+
+	seconds := d.Seconds()
+
+	return &seconds
+}
+
+// parseAlarmDuration parses the duration of an alarm, a .NET time span like
+// "1.02:03:04.5" ([-][d.]hh:mm:ss[.fffffff]), an ISO 8601 duration like
+// "P1DT2H3M4.5S", or a Go duration.
+func parseAlarmDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+
+	switch {
+	case s == "":
+		return 0, errors.New("empty duration")
+	case strings.HasPrefix(s, "P") || strings.HasPrefix(s, "-P"):
+		return parseISODuration(s)
+	case strings.Contains(s, ":"):
+		return parseTimeSpan(s)
+	}
+
+	return time.ParseDuration(s)
+}
+
+func parseTimeSpan(s string) (time.Duration, error) {
+	sign := time.Duration(1)
+
+	if strings.HasPrefix(s, "-") {
+		sign = -1
+		s = s[1:]
+	}
+
+	var days int64
+
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid time span '%s'", s)
+	}
+
+	hours := parts[0]
+
+	if i := strings.Index(hours, "."); i >= 0 {
+		var err error
+
+		days, err = strconv.ParseInt(hours[:i], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid time span '%s': %w", s, err)
+		}
+
+		hours = hours[i+1:]
+	}
+
+	h, err := strconv.ParseInt(hours, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time span '%s': %w", s, err)
+	}
+
+	m, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time span '%s': %w", s, err)
+	}
+
+	sec, err := strconv.ParseFloat(parts[2], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time span '%s': %w", s, err)
+	}
+
+	d := time.Duration(days)*24*time.Hour + time.Duration(h)*time.Hour + time.Duration(m)*time.Minute +
+		time.Duration(sec*float64(time.Second))
+
+	return sign * d, nil
+}
+
+// isoDurationUnits are the units of the ISO 8601 duration designators, years
+// and months are not supported as their length varies.
+var isoDurationUnits = map[byte]time.Duration{
+	'W': 7 * 24 * time.Hour,
+	'D': 24 * time.Hour,
+	'H': time.Hour,
+	'S': time.Second,
+}
+
+func parseISODuration(s string) (time.Duration, error) {
+	sign := time.Duration(1)
+	rest := s
+
+	if strings.HasPrefix(rest, "-") {
+		sign = -1
+		rest = rest[1:]
+	}
+
+	rest = strings.TrimPrefix(rest, "P")
+	inTime := false
+
+	var d time.Duration
+
+	for rest != "" {
+		if rest[0] == 'T' {
+			inTime = true
+			rest = rest[1:]
+
+			continue
+		}
+
+		i := strings.IndexAny(rest, "WDHMS")
+		if i <= 0 {
+			return 0, fmt.Errorf("invalid ISO 8601 duration '%s'", s)
+		}
+
+		v, err := strconv.ParseFloat(rest[:i], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid ISO 8601 duration '%s': %w", s, err)
+		}
+
+		unit, ok := isoDurationUnits[rest[i]]
+		if rest[i] == 'M' {
+			if !inTime {
+				return 0, fmt.Errorf("unsupported ISO 8601 duration '%s': months", s)
+			}
+
+			unit, ok = time.Minute, true
+		}
+
+		if !ok {
+			return 0, fmt.Errorf("invalid ISO 8601 duration '%s'", s)
+		}
+
+		d += time.Duration(v * float64(unit))
+		rest = rest[i+1:]
+	}
+
+	return sign * d, nil
+}
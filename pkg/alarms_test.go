@@ -0,0 +1,9 @@
+package main
+
+import "testing"
+
+func TestAnnotationTags(t *testing.T) {
+	if got := annotationTags("Shop, Berlin,DE", "Timeout"); got != "Shop Berlin DE,Timeout" {
+		t.Errorf("annotationTags = %q", got)
+	}
+}
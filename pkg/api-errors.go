@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Kinds of API errors, use errors.Is to check the kind of an error.
+var (
+	errAuth                = errors.New("authentication failed, check the API token and its permissions")
+	errNotFound            = errors.New("not found")
+	errRateLimited         = errors.New("rate limited by the TeamViewer API")
+	errUpstreamUnavailable = errors.New("TeamViewer API unavailable")
+	errDecode              = errors.New("invalid response from the TeamViewer API")
+	errRequestRejected     = errors.New("request rejected by the TeamViewer API")
+	errTimeout             = errors.New("request canceled or timed out")
+	errResponseTooLarge    = errors.New("response of the TeamViewer API too large")
+)
+
+// maxErrorMessageLength limits the upstream error body kept in an apiError.
+const maxErrorMessageLength = 512
+
+// apiError is an error of a TeamViewer Web API call.
+type apiError struct {
+	// Kind is one of the err* kinds above
+	Kind error
+	// StatusCode and Status of the response, empty if no response was received
+	StatusCode int
+	Status     string
+	// Message is the error reported by the TeamViewer API
+	Message string
+	// RetryAfter is the delay requested with the Retry-After header
+	RetryAfter time.Duration
+	// Err is the underlying error, if any
+	Err error
+}
+
+func (e *apiError) Error() string {
+	msg := e.Kind.Error()
+
+	if e.Status != "" {
+		msg += " (" + e.Status + ")"
+	}
+
+	switch {
+	case e.Message != "":
+		msg += ": " + e.Message
+	case e.Err != nil:
+		msg += ": " + e.Err.Error()
+	}
+
+	return msg
+}
+
+// Is reports whether target is the kind of the error.
+func (e *apiError) Is(target error) bool {
+	return target == e.Kind
+}
+
+func (e *apiError) Unwrap() error {
+	return e.Err
+}
+
+// teamViewerError is the error body returned by the TeamViewer API.
+type teamViewerError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+	ErrorCode        int    `json:"error_code"`
+}
+
+// newStatusError returns the error for a response with an unexpected status.
+func newStatusError(res *http.Response, body []byte) *apiError {
+	var kind error
+
+	switch {
+	case res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden:
+		kind = errAuth
+	case res.StatusCode == http.StatusNotFound:
+		kind = errNotFound
+	case res.StatusCode == http.StatusTooManyRequests:
+		kind = errRateLimited
+	case res.StatusCode >= http.StatusInternalServerError:
+		kind = errUpstreamUnavailable
+	default:
+		kind = errRequestRejected
+	}
+
+	return &apiError{
+		Kind:       kind,
+		StatusCode: res.StatusCode,
+		Status:     res.Status,
+		Message:    errorMessage(body),
+		RetryAfter: parseRetryAfter(res.Header.Get("Retry-After"), time.Now()),
+	}
+}
+
+// newDecodeError returns the error for a response that couldn't be decoded.
+func newDecodeError(err error) *apiError {
+	return &apiError{
+		Kind: errDecode,
+		Err:  err,
+	}
+}
+
+// errorMessage extracts the error message from a TeamViewer API error body.
+func errorMessage(body []byte) string {
+	var tvErr teamViewerError
+
+	if err := json.Unmarshal(body, &tvErr); err == nil {
+		switch {
+		case tvErr.ErrorDescription != "":
+			return tvErr.ErrorDescription
+		case tvErr.Error != "":
+			return tvErr.Error
+		}
+	}
+
+	msg := strings.TrimSpace(string(body))
+	if len(msg) > maxErrorMessageLength {
+		msg = msg[:maxErrorMessageLength] + "..."
+	}
+
+	return msg
+}
+
+// httpStatus maps an error to the HTTP status returned by CallResource.
+func httpStatus(err error) int {
+	switch {
+	case errors.Is(err, errAuth):
+		// 401 would make Grafana end the session of the user
+		return http.StatusForbidden
+	case errors.Is(err, errNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errRateLimited):
+		return http.StatusTooManyRequests
+	case errors.Is(err, errUpstreamUnavailable), errors.Is(err, errDecode), errors.Is(err, errResponseTooLarge):
+		return http.StatusBadGateway
+	case errors.Is(err, errTimeout):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, errRequestRejected):
+		return http.StatusBadRequest
+	}
+
+	return http.StatusInternalServerError
+}
+
+// errorResponseBody returns the JSON body of an error response, Grafana shows
+// the message to the user.
+func errorResponseBody(msg string, err error) []byte {
+	b, _ := json.Marshal(map[string]string{
+		"message": fmt.Sprintf("%s: %s", msg, err.Error()),
+	})
+
+	return b
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Classified monitor result statuses.
+const (
+	statusUp       = "up"
+	statusDown     = "down"
+	statusDegraded = "degraded"
+	statusUnknown  = "unknown"
+)
+
+// classifyStatus maps the status of a monitor result to up, down, degraded or unknown.
+func classifyStatus(status string) string {
+	switch strings.ToLower(status) {
+	case "up", "ok", "success", "successful", "available", "online":
+		return statusUp
+	case "down", "error", "failed", "failure", "unavailable", "offline", "timeout":
+		return statusDown
+	case "degraded", "warning", "slow":
+		return statusDegraded
+	}
+
+	return statusUnknown
+}
+
+// availabilityValues maps the statuses to 1 if available and 0 if not. Degraded
+// results count as available, results with an unknown status are skipped and
+// counted by status.
+func availabilityValues(lr *locationResults) ([]time.Time, []int32, map[string]int) {
+	times := make([]time.Time, 0, len(lr.times))
+	values := make([]int32, 0, len(lr.times))
+	unknown := make(map[string]int)
+
+	for i, status := range lr.statuses {
+		switch classifyStatus(status) {
+		case statusUp, statusDegraded:
+			values = append(values, 1)
+		case statusDown:
+			values = append(values, 0)
+		default:
+			unknown[status]++
+
+			continue
+		}
+
+		times = append(times, lr.times[i])
+	}
+
+	return times, values, unknown
+}
+
+// unknownStatusNotice returns a notice about the results skipped because of an
+// unknown status, so a status missing in classifyStatus doesn't go unnoticed.
+func unknownStatusNotice(unknown map[string]int) data.Notice {
+	statuses := make([]string, 0, len(unknown))
+	total := 0
+
+	for status, n := range unknown {
+		statuses = append(statuses, fmt.Sprintf("'%s' (%d)", status, n))
+		total += n
+	}
+
+	sort.Strings(statuses)
+
+	return data.Notice{
+		Severity: data.NoticeSeverityWarning,
+		Text:     fmt.Sprintf("%d results with an unknown status skipped: %s", total, strings.Join(statuses, ", ")),
+	}
+}
+
+// aggregateAvailability returns the percentage of available results.
+func aggregateAvailability(values []float64) float64 {
+	return aggregateAvg(values) * 100
+}
+
+// queryAvailability returns the uptime percentage per location and overall
+// for each monitor, either for the dashboard range or per interval.
+func (td *WebMonitoringDatasource) queryAvailability(ctx context.Context, inst *instanceSettings, query *backend.DataQuery,
+	qm *queryModel, apiToken string) backend.DataResponse {
+	response := backend.DataResponse{}
+
+	sets, locations, err := inst.getQueryMonitorResults(ctx, query, qm, apiToken)
+	if err != nil {
+		response.Error = err
+
+		return response
+	}
+
+	for i := range sets {
+		monitorResults := sets[i].results
+
+		var overallTimes []time.Time
+
+		var overallValues []int32
+
+		for _, locationID := range sortedLocationIDs(monitorResults, locations) {
+			times, values, unknown := availabilityValues(monitorResults[locationID])
+			if len(times) == 0 && len(unknown) == 0 {
+				continue
+			}
+
+			overallTimes = append(overallTimes, times...)
+			overallValues = append(overallValues, values...)
+
+			name := seriesName(qm, &sets[i].monitor, locations.name(locationID))
+			labels := locations.labels(&sets[i].monitor, locationID)
+			frame := availabilityFrame(query, qm, name, labels, times, values)
+
+			// Locations with only unknown statuses get an empty series carrying the notice
+			if len(unknown) > 0 {
+				frame.AppendNotices(unknownStatusNotice(unknown))
+			}
+
+			response.Frames = append(response.Frames, locations.noticeMissing(frame, locationID))
+		}
+
+		if len(overallTimes) > 0 {
+			name := seriesName(qm, &sets[i].monitor, "Overall")
+			labels := monitorLabels(&sets[i].monitor)
+			labels["location"] = "overall"
+			response.Frames = append(response.Frames, availabilityFrame(query, qm, name, labels, overallTimes,
+				overallValues))
+		}
+	}
+
+	return response
+}
+
+// availabilityFrame creates the frame of one series, with a single value at
+// the end of the range or one value per interval.
+func availabilityFrame(query *backend.DataQuery, qm *queryModel, name string, labels data.Labels, times []time.Time,
+	values []int32) *data.Frame {
+	var bucketTimes []time.Time
+
+	var bucketValues []float64
+
+	switch {
+	case len(values) == 0:
+		bucketTimes, bucketValues = []time.Time{}, []float64{}
+	case qm.PerInterval:
+		bucketTimes, bucketValues = aggregateSeries(times, values, aggregationInterval(query), aggregateAvailability)
+	default:
+		samples := make([]float64, len(values))
+		for i, v := range values {
+			samples[i] = float64(v)
+		}
+
+		bucketTimes = []time.Time{query.TimeRange.To}
+		bucketValues = []float64{aggregateAvailability(samples)}
+	}
+
+	return seriesFrame(name, bucketTimes, "availability", labels, bucketValues, &data.FieldConfig{
+		Unit: "percent",
+		Min:  confFloat64(0),
+		Max:  confFloat64(100),
+	})
+}
+
+func confFloat64(v float64) *data.ConfFloat64 {
+	f := data.ConfFloat64(v)
+
+	return &f
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAvailabilityValuesUnknownStatus(t *testing.T) {
+	base := time.Date(2021, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	lr := &locationResults{
+		times:    []time.Time{base, base.Add(time.Minute), base.Add(2 * time.Minute), base.Add(3 * time.Minute)},
+		statuses: []string{"Ok", "Maintenance", "Error", "Maintenance"},
+	}
+
+	times, values, unknown := availabilityValues(lr)
+	if len(times) != 2 || values[0] != 1 || values[1] != 0 {
+		t.Errorf("times = %v, values = %v, want the Ok and Error results", times, values)
+	}
+
+	if unknown["Maintenance"] != 2 || len(unknown) != 1 {
+		t.Errorf("unknown = %v, want 2 Maintenance results", unknown)
+	}
+
+	if got, want := unknownStatusNotice(unknown).Text, "2 results with an unknown status skipped: 'Maintenance' (2)"; got != want {
+		t.Errorf("notice = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Cache keys of the catalogues.
+const (
+	cacheKeyMonitors  = "monitors"
+	cacheKeyLocations = "locations"
+)
+
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// ttlCache is an in-memory cache whose entries expire after a TTL. Cached
+// values are shared and must not be modified.
+type ttlCache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+func newTTLCache() *ttlCache {
+	return &ttlCache{
+		entries: make(map[string]cacheEntry),
+	}
+}
+
+// Get returns the value stored for key, if it has not expired.
+func (c *ttlCache) Get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	if time.Now().After(entry.expires) {
+		delete(c.entries, key)
+
+		return nil, false
+	}
+
+	return entry.value, true
+}
+
+// Set stores value for key for the duration of ttl. Values with a TTL that is
+// not positive are not stored.
+func (c *ttlCache) Set(key string, value interface{}, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[key] = cacheEntry{
+		value:   value,
+		expires: time.Now().Add(ttl),
+	}
+}
+
+// Flush removes all entries and returns how many were removed.
+func (c *ttlCache) Flush() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := len(c.entries)
+	c.entries = make(map[string]cacheEntry)
+
+	return n
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// Default endpoint paths, relative to the API base URL.
+const (
+	defaultPingPath           = "/ping"
+	defaultLocationsPath      = "/webMonitoring/locations"
+	defaultMonitorsPath       = "/webMonitoring/monitors"
+	defaultMonitorResultsPath = "/webMonitoring/monitorResults"
+	defaultAlarmsPath         = "/webMonitoring/alarms"
+)
+
+// endpointSettings holds the per-endpoint path overrides. Empty values fall
+// back to the default TeamViewer Web API paths.
+type endpointSettings struct {
+	Ping           string `json:"ping"`
+	Locations      string `json:"locations"`
+	Monitors       string `json:"monitors"`
+	MonitorResults string `json:"monitorResults"`
+	Alarms         string `json:"alarms"`
+}
+
+// Default HTTP client settings.
+const (
+	defaultTimeout      = 30 * time.Second
+	defaultDialTimeout  = 10 * time.Second
+	defaultMaxIdleConns = 100
+
+	defaultMaxResponseSize = 32 << 20
+)
+
+// Default safety limits of paginated API responses.
+const (
+	defaultMaxPages = 1000
+	defaultMaxItems = 5000000
+)
+
+// Default retry settings.
+const (
+	defaultMaxRetries     = 3
+	defaultRetryBaseDelay = 500 * time.Millisecond
+	defaultRetryMaxDelay  = 10 * time.Second
+)
+
+// Default client-side rate limit.
+const (
+	defaultRateLimit      = 10
+	defaultRateLimitBurst = 20
+)
+
+// Default cache TTLs of the monitor and location catalogues.
+const (
+	defaultMonitorsCacheTTL  = time.Minute
+	defaultLocationsCacheTTL = time.Hour
+)
+
+// Default results cache settings, a monitor result takes roughly 100 bytes.
+const (
+	defaultResultsCacheBucket     = time.Hour
+	defaultResultsCacheMaxResults = 1000000
+)
+
+// Default query execution settings.
+const (
+	defaultMaxConcurrentQueries = 5
+	defaultQueryTimeout         = 2 * time.Minute
+)
+
+// datasourceSettings is the datasource configuration stored in jsonData.
+type datasourceSettings struct {
+	APIBaseURL string           `json:"apiBaseURL"`
+	Endpoints  endpointSettings `json:"endpoints"`
+
+	// HTTP client, timeouts are in seconds
+	Timeout           int    `json:"timeout"`
+	DialTimeout       int    `json:"dialTimeout"`
+	MaxIdleConns      int    `json:"maxIdleConns"`
+	ProxyURL          string `json:"proxyURL"`
+	TLSAuth           bool   `json:"tlsAuth"`
+	TLSAuthWithCACert bool   `json:"tlsAuthWithCACert"`
+	TLSSkipVerify     bool   `json:"tlsSkipVerify"`
+
+	// Maximum size of a response body in bytes
+	MaxResponseSize int64 `json:"maxResponseSize"`
+
+	// Limits of paginated responses
+	MaxPages int `json:"maxPages"`
+	MaxItems int `json:"maxItems"`
+
+	// Retries, delays are in milliseconds. A negative MaxRetries disables retries.
+	MaxRetries     int `json:"maxRetries"`
+	RetryBaseDelay int `json:"retryBaseDelay"`
+	RetryMaxDelay  int `json:"retryMaxDelay"`
+
+	// Client-side rate limit in requests per second. A negative RateLimit disables it.
+	RateLimit      float64 `json:"rateLimit"`
+	RateLimitBurst int     `json:"rateLimitBurst"`
+
+	// Cache TTLs in seconds. A negative TTL disables caching.
+	MonitorsCacheTTL  int `json:"monitorsCacheTTL"`
+	LocationsCacheTTL int `json:"locationsCacheTTL"`
+
+	// Monitor results cache, the bucket size is in seconds. A negative
+	// ResultsCacheMaxResults disables the cache.
+	ResultsCacheBucket     int `json:"resultsCacheBucket"`
+	ResultsCacheMaxResults int `json:"resultsCacheMaxResults"`
+
+	// Query execution, the timeout is in seconds
+	MaxConcurrentQueries int `json:"maxConcurrentQueries"`
+	QueryTimeout         int `json:"queryTimeout"`
+
+	// Values from the secureJsonData
+	TLSCACert     string `json:"-"`
+	TLSClientCert string `json:"-"`
+	TLSClientKey  string `json:"-"`
+}
+
+// loadDatasourceSettings parses the jsonData of the datasource and fills in
+// defaults for every value that is not configured.
+func loadDatasourceSettings(setting backend.DataSourceInstanceSettings) (datasourceSettings, error) {
+	var s datasourceSettings
+
+	if len(setting.JSONData) > 0 {
+		if err := json.Unmarshal(setting.JSONData, &s); err != nil {
+			return s, fmt.Errorf("parsing jsonData: %w", err)
+		}
+	}
+
+	s.APIBaseURL = strings.TrimSpace(s.APIBaseURL)
+	if s.APIBaseURL == "" {
+		s.APIBaseURL = webMonitingAPIBasePath
+	}
+
+	u, err := url.Parse(s.APIBaseURL)
+	if err != nil {
+		return s, fmt.Errorf("invalid API base URL: %w", err)
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return s, fmt.Errorf("invalid API base URL '%s': scheme must be http or https and host must be set", s.APIBaseURL)
+	}
+
+	s.APIBaseURL = strings.TrimRight(s.APIBaseURL, "/")
+
+	s.Endpoints.Ping = endpointPath(s.Endpoints.Ping, defaultPingPath)
+	s.Endpoints.Locations = endpointPath(s.Endpoints.Locations, defaultLocationsPath)
+	s.Endpoints.Monitors = endpointPath(s.Endpoints.Monitors, defaultMonitorsPath)
+	s.Endpoints.MonitorResults = endpointPath(s.Endpoints.MonitorResults, defaultMonitorResultsPath)
+	s.Endpoints.Alarms = endpointPath(s.Endpoints.Alarms, defaultAlarmsPath)
+
+	if s.ProxyURL != "" {
+		if _, err := url.Parse(s.ProxyURL); err != nil {
+			return s, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+	}
+
+	s.TLSCACert = setting.DecryptedSecureJSONData["tlsCACert"]
+	s.TLSClientCert = setting.DecryptedSecureJSONData["tlsClientCert"]
+	s.TLSClientKey = setting.DecryptedSecureJSONData["tlsClientKey"]
+
+	return s, nil
+}
+
+// endpointPath returns the configured path with a leading slash, or the
+// default path if none is configured.
+func endpointPath(configured, defaultPath string) string {
+	configured = strings.TrimSpace(configured)
+	if configured == "" {
+		return defaultPath
+	}
+
+	if !strings.HasPrefix(configured, "/") {
+		configured = "/" + configured
+	}
+
+	return configured
+}
+
+// timeout returns the overall request timeout.
+func (s *datasourceSettings) timeout() time.Duration {
+	if s.Timeout <= 0 {
+		return defaultTimeout
+	}
+
+	return time.Duration(s.Timeout) * time.Second
+}
+
+// dialTimeout returns the timeout for establishing a connection.
+func (s *datasourceSettings) dialTimeout() time.Duration {
+	if s.DialTimeout <= 0 {
+		return defaultDialTimeout
+	}
+
+	return time.Duration(s.DialTimeout) * time.Second
+}
+
+// maxIdleConns returns the size of the idle connection pool.
+func (s *datasourceSettings) maxIdleConns() int {
+	if s.MaxIdleConns <= 0 {
+		return defaultMaxIdleConns
+	}
+
+	return s.MaxIdleConns
+}
+
+// maxResponseSize returns the maximum size of a response body.
+func (s *datasourceSettings) maxResponseSize() int64 {
+	if s.MaxResponseSize <= 0 {
+		return defaultMaxResponseSize
+	}
+
+	return s.MaxResponseSize
+}
+
+// maxPages returns the maximum number of pages requested for a paginated response.
+func (s *datasourceSettings) maxPages() int {
+	if s.MaxPages <= 0 {
+		return defaultMaxPages
+	}
+
+	return s.MaxPages
+}
+
+// maxItems returns the maximum number of items of a paginated response.
+func (s *datasourceSettings) maxItems() int {
+	if s.MaxItems <= 0 {
+		return defaultMaxItems
+	}
+
+	return s.MaxItems
+}
+
+// maxRetries returns the number of retries after the first attempt.
+func (s *datasourceSettings) maxRetries() int {
+	switch {
+	case s.MaxRetries < 0:
+		return 0
+	case s.MaxRetries == 0:
+		return defaultMaxRetries
+	}
+
+	return s.MaxRetries
+}
+
+// retryBaseDelay returns the backoff delay of the first retry.
+func (s *datasourceSettings) retryBaseDelay() time.Duration {
+	if s.RetryBaseDelay <= 0 {
+		return defaultRetryBaseDelay
+	}
+
+	return time.Duration(s.RetryBaseDelay) * time.Millisecond
+}
+
+// retryMaxDelay returns the upper bound of the backoff delay.
+func (s *datasourceSettings) retryMaxDelay() time.Duration {
+	if s.RetryMaxDelay <= 0 {
+		return defaultRetryMaxDelay
+	}
+
+	return time.Duration(s.RetryMaxDelay) * time.Millisecond
+}
+
+// rateLimit returns the allowed requests per second, 0 if unlimited.
+func (s *datasourceSettings) rateLimit() float64 {
+	switch {
+	case s.RateLimit < 0:
+		return 0
+	case s.RateLimit == 0:
+		return defaultRateLimit
+	}
+
+	return s.RateLimit
+}
+
+// rateLimitBurst returns the number of requests allowed in a burst.
+func (s *datasourceSettings) rateLimitBurst() int {
+	if s.RateLimitBurst <= 0 {
+		return defaultRateLimitBurst
+	}
+
+	return s.RateLimitBurst
+}
+
+// monitorsCacheTTL returns how long the monitors are cached, 0 if not cached.
+func (s *datasourceSettings) monitorsCacheTTL() time.Duration {
+	return cacheTTL(s.MonitorsCacheTTL, defaultMonitorsCacheTTL)
+}
+
+// locationsCacheTTL returns how long the locations are cached, 0 if not cached.
+func (s *datasourceSettings) locationsCacheTTL() time.Duration {
+	return cacheTTL(s.LocationsCacheTTL, defaultLocationsCacheTTL)
+}
+
+func cacheTTL(seconds int, defaultTTL time.Duration) time.Duration {
+	switch {
+	case seconds < 0:
+		return 0
+	case seconds == 0:
+		return defaultTTL
+	}
+
+	return time.Duration(seconds) * time.Second
+}
+
+// resultsCacheBucket returns the time bucket size of the results cache.
+func (s *datasourceSettings) resultsCacheBucket() time.Duration {
+	if s.ResultsCacheBucket <= 0 {
+		return defaultResultsCacheBucket
+	}
+
+	return time.Duration(s.ResultsCacheBucket) * time.Second
+}
+
+// resultsCacheMaxResults returns the number of results cached, 0 if not cached.
+func (s *datasourceSettings) resultsCacheMaxResults() int {
+	switch {
+	case s.ResultsCacheMaxResults < 0:
+		return 0
+	case s.ResultsCacheMaxResults == 0:
+		return defaultResultsCacheMaxResults
+	}
+
+	return s.ResultsCacheMaxResults
+}
+
+// maxConcurrentQueries returns how many queries of a request run concurrently.
+func (s *datasourceSettings) maxConcurrentQueries() int {
+	if s.MaxConcurrentQueries <= 0 {
+		return defaultMaxConcurrentQueries
+	}
+
+	return s.MaxConcurrentQueries
+}
+
+// queryTimeout returns the timeout of a single query.
+func (s *datasourceSettings) queryTimeout() time.Duration {
+	if s.QueryTimeout <= 0 {
+		return defaultQueryTimeout
+	}
+
+	return time.Duration(s.QueryTimeout) * time.Second
+}
+
+// apiURL returns the absolute URL for an endpoint path.
+func (s *datasourceSettings) apiURL(path string) string {
+	return s.APIBaseURL + path
+}
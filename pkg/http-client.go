@@ -0,0 +1,94 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Transport timeouts that are not configurable.
+const (
+	keepAlive             = 30 * time.Second
+	idleConnTimeout       = 90 * time.Second
+	tlsHandshakeTimeout   = 10 * time.Second
+	expectContinueTimeout = 1 * time.Second
+)
+
+// newHTTPClient creates the HTTP client shared by all API calls of a datasource instance.
+func newHTTPClient(settings *datasourceSettings) (*http.Client, error) {
+	tlsConfig, err := newTLSConfig(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	proxy := http.ProxyFromEnvironment
+
+	if settings.ProxyURL != "" {
+		proxyURL, err := url.Parse(settings.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	transport := &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   settings.dialTimeout(),
+			KeepAlive: keepAlive,
+		}).DialContext,
+		TLSClientConfig:       tlsConfig,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          settings.maxIdleConns(),
+		MaxIdleConnsPerHost:   settings.maxIdleConns(),
+		IdleConnTimeout:       idleConnTimeout,
+		TLSHandshakeTimeout:   tlsHandshakeTimeout,
+		ExpectContinueTimeout: expectContinueTimeout,
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   settings.timeout(),
+	}, nil
+}
+
+// newTLSConfig creates the TLS configuration, adding a custom CA bundle and
+// a client certificate if configured.
+func newTLSConfig(settings *datasourceSettings) (*tls.Config, error) {
+	// InsecureSkipVerify is only meant for lab setups and has to be enabled explicitly.
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: settings.TLSSkipVerify, //nolint:gosec
+	}
+
+	if settings.TLSAuthWithCACert {
+		if settings.TLSCACert == "" {
+			return nil, errors.New("TLS CA certificate enabled, but no CA certificate configured")
+		}
+
+		caPool := x509.NewCertPool()
+
+		if ok := caPool.AppendCertsFromPEM([]byte(settings.TLSCACert)); !ok {
+			return nil, errors.New("failed to parse TLS CA PEM certificate")
+		}
+
+		tlsConfig.RootCAs = caPool
+	}
+
+	if settings.TLSAuth {
+		cert, err := tls.X509KeyPair([]byte(settings.TLSClientCert), []byte(settings.TLSClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid TLS client certificate: %w", err)
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
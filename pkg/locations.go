@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Location group-by options of the monitor results.
+const (
+	groupByNone      = "none"
+	groupByContinent = "continent"
+	groupByCountry   = "country"
+)
+
+// locationIndex is the location metadata by location ID.
+type locationIndex map[int]location
+
+func newLocationIndex(locations []location) locationIndex {
+	index := make(locationIndex, len(locations))
+
+	for i := range locations {
+		index[locations[i].LocationID] = locations[i]
+	}
+
+	return index
+}
+
+// name returns the display name of a location, a synthetic name if the
+// location has no metadata. Locations in the same city are told apart by ID.
+func (li locationIndex) name(locationID int) string {
+	l, ok := li[locationID]
+	if !ok {
+		return fmt.Sprintf("Location %d", locationID)
+	}
+
+	name := l.City + " (" + strings.ToUpper(l.CountryCode) + ")"
+
+	for id, other := range li {
+		if id != locationID && strings.EqualFold(other.City, l.City) && strings.EqualFold(other.CountryCode, l.CountryCode) {
+			return fmt.Sprintf("%s #%d", name, locationID)
+		}
+	}
+
+	return name
+}
+
+// labels returns the labels of the series of a monitor and location.
+func (li locationIndex) labels(m *monitor, locationID int) data.Labels {
+	labels := monitorLabels(m)
+	labels["location_id"] = strconv.Itoa(locationID)
+
+	if l, ok := li[locationID]; ok {
+		labels["city"] = l.City
+		labels["country"] = strings.ToUpper(l.CountryCode)
+		labels["continent"] = l.Continent
+	}
+
+	return labels
+}
+
+// noticeMissing appends a notice to the frame of a location without metadata.
+func (li locationIndex) noticeMissing(frame *data.Frame, locationID int) *data.Frame {
+	if _, ok := li[locationID]; !ok {
+		frame.AppendNotices(data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text:     fmt.Sprintf("Location %d is not in the locations of the API, city and country are unknown", locationID),
+		})
+	}
+
+	return frame
+}
+
+// selected returns whether a location matches the allow-list by ID, country
+// code, continent or city. An empty allow-list selects all locations.
+func (li locationIndex) selected(allow []string, locationID int) bool {
+	if len(allow) == 0 {
+		return true
+	}
+
+	l, ok := li[locationID]
+
+	for _, a := range allow {
+		a = strings.TrimSpace(a)
+
+		if a == strconv.Itoa(locationID) {
+			return true
+		}
+
+		if ok && (strings.EqualFold(a, l.CountryCode) || strings.EqualFold(a, l.Continent) || strings.EqualFold(a, l.City)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// filter returns the results of the locations matching the allow-list.
+func (li locationIndex) filter(results resultColumns, allow []string) resultColumns {
+	if len(allow) == 0 {
+		return results
+	}
+
+	filtered := make(resultColumns)
+
+	for locationID, lr := range results {
+		if li.selected(allow, locationID) {
+			filtered[locationID] = lr
+		}
+	}
+
+	return filtered
+}
+
+// group returns the group of a location, "Unknown" if the location has no metadata.
+func (li locationIndex) group(groupBy string, locationID int) string {
+	l, ok := li[locationID]
+
+	var group string
+
+	if ok {
+		switch groupBy {
+		case groupByContinent:
+			group = l.Continent
+		case groupByCountry:
+			group = strings.ToUpper(l.CountryCode)
+		}
+	}
+
+	if group == "" {
+		return "Unknown"
+	}
+
+	return group
+}
+
+// validGroupBy returns an error for unknown group-by options.
+func validGroupBy(groupBy string) error {
+	switch groupBy {
+	case "", groupByNone, groupByContinent, groupByCountry:
+		return nil
+	}
+
+	return fmt.Errorf("unknown group by '%s'", groupBy)
+}
+
+// locationGroup are the results of the locations of a group, merged in time order.
+type locationGroup struct {
+	name          string
+	times         []time.Time
+	responseTimes []int32
+}
+
+func (g *locationGroup) Len() int { return len(g.times) }
+
+func (g *locationGroup) Less(i, j int) bool { return g.times[i].Before(g.times[j]) }
+
+func (g *locationGroup) Swap(i, j int) {
+	g.times[i], g.times[j] = g.times[j], g.times[i]
+	g.responseTimes[i], g.responseTimes[j] = g.responseTimes[j], g.responseTimes[i]
+}
+
+// groupLocations merges the results of the locations by group, sorted by group name.
+func (li locationIndex) groupLocations(results resultColumns, groupBy string) []*locationGroup {
+	groups := make(map[string]*locationGroup)
+
+	for locationID, lr := range results {
+		name := li.group(groupBy, locationID)
+
+		g, ok := groups[name]
+		if !ok {
+			g = &locationGroup{name: name}
+			groups[name] = g
+		}
+
+		g.times = append(g.times, lr.times...)
+		g.responseTimes = append(g.responseTimes, lr.responseTimes...)
+	}
+
+	sorted := make([]*locationGroup, 0, len(groups))
+
+	for _, g := range groups {
+		sort.Stable(g)
+		sorted = append(sorted, g)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].name < sorted[j].name })
+
+	return sorted
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// queryMonitorResults returns the response times of the selected monitors,
+// one frame per monitor and location, or per monitor and location group.
+func (td *WebMonitoringDatasource) queryMonitorResults(ctx context.Context, inst *instanceSettings, query *backend.DataQuery,
+	qm *queryModel, apiToken string) backend.DataResponse {
+	response := backend.DataResponse{}
+
+	agg, err := getAggregator(qm.Aggregation)
+	if err != nil {
+		response.Error = err
+
+		return response
+	}
+
+	if err := validGroupBy(qm.GroupBy); err != nil {
+		response.Error = err
+
+		return response
+	}
+
+	interval := aggregationInterval(query)
+
+	sets, locations, err := inst.getQueryMonitorResults(ctx, query, qm, apiToken)
+	if err != nil {
+		response.Error = err
+
+		return response
+	}
+
+	for i := range sets {
+		monitorResults := sets[i].results
+
+		log.DefaultLogger.Info(fmt.Sprintf("MonitorID: %v", sets[i].monitor.MonitorID))
+
+		if qm.GroupBy != "" && qm.GroupBy != groupByNone {
+			response.Frames = append(response.Frames, groupFrames(qm, &sets[i].monitor, locations, monitorResults,
+				interval, agg)...)
+
+			continue
+		}
+
+		for _, locationID := range sortedLocationIDs(monitorResults, locations) {
+			locationName := locations.name(locationID)
+
+			log.DefaultLogger.Debug(fmt.Sprintf("LocationID: %v, LocationName: %v, %v entries",
+				locationID, locationName, len(monitorResults[locationID].times)))
+
+			name := seriesName(qm, &sets[i].monitor, locationName)
+			labels := locations.labels(&sets[i].monitor, locationID)
+
+			// create data frame response
+			var frame *data.Frame
+
+			if agg == nil {
+				frame = seriesFrame(name, monitorResults[locationID].times, "response_time", labels,
+					monitorResults[locationID].responseTimes, responseTimeConfig(qm))
+			} else {
+				times, values := aggregateSeries(monitorResults[locationID].times, monitorResults[locationID].responseTimes,
+					interval, agg)
+
+				frame = seriesFrame(name, times, "response_time", labels, values, responseTimeConfig(qm))
+			}
+
+			// add the frames to the response
+			response.Frames = append(response.Frames, locations.noticeMissing(frame, locationID))
+		}
+	}
+
+	return response
+}
+
+// groupFrames returns the response times aggregated across the locations of
+// each group, the average per interval if no aggregation is selected.
+func groupFrames(qm *queryModel, m *monitor, locations locationIndex, results resultColumns, interval time.Duration,
+	agg aggregator) []*data.Frame {
+	if agg == nil {
+		agg = aggregators["avg"]
+	}
+
+	frames := make([]*data.Frame, 0)
+
+	for _, g := range locations.groupLocations(results, qm.GroupBy) {
+		times, values := aggregateSeries(g.times, g.responseTimes, interval, agg)
+
+		labels := monitorLabels(m)
+		labels[qm.GroupBy] = g.name
+
+		frames = append(frames, seriesFrame(seriesName(qm, m, g.name), times, "response_time", labels, values,
+			responseTimeConfig(qm)))
+	}
+
+	return frames
+}
+
+// responseTimeConfig returns the field config of the response times.
+func responseTimeConfig(qm *queryModel) *data.FieldConfig {
+	config := &data.FieldConfig{}
+	config.Unit = "ms"
+
+	if qm.Aggregation == "count" {
+		config.Unit = "none"
+	}
+
+	return config
+}
+
+// sortedLocationIDs returns the location IDs of the results sorted by location
+// name, locations of the same name by ID.
+func sortedLocationIDs(results resultColumns, locations locationIndex) []int {
+	locationIDs := make([]int, 0, len(results))
+	for locationID := range results {
+		locationIDs = append(locationIDs, locationID)
+	}
+
+	sort.Slice(locationIDs, func(i, j int) bool {
+		if locations.name(locationIDs[i]) != locations.name(locationIDs[j]) {
+			return locations.name(locationIDs[i]) < locations.name(locationIDs[j])
+		}
+
+		return locationIDs[i] < locationIDs[j]
+	})
+
+	return locationIDs
+}
+
+// locationResults are the monitor results of one location, stored as columns.
+type locationResults struct {
+	times         []time.Time
+	responseTimes []int32
+	statuses      []string
+}
+
+// resultColumns are the monitor results by location ID. Results are
+// decoded directly into the columns, so memory stays proportional to the
+// frames built from them.
+type resultColumns map[int]*locationResults
+
+func (c resultColumns) add(mr *monitorResult) {
+	lr, ok := c[mr.LocationID]
+	if !ok {
+		lr = &locationResults{}
+		c[mr.LocationID] = lr
+	}
+
+	status := mr.Status
+
+	// Share the string with the previous result, most results have the same status
+	if n := len(lr.statuses); n > 0 && lr.statuses[n-1] == status {
+		status = lr.statuses[n-1]
+	}
+
+	lr.times = append(lr.times, mr.Time)
+	lr.responseTimes = append(lr.responseTimes, int32(mr.ResponseTime))
+	lr.statuses = append(lr.statuses, status)
+}
+
+// len returns the number of results of all locations.
+func (c resultColumns) len() int {
+	n := 0
+
+	for _, lr := range c {
+		n += len(lr.times)
+	}
+
+	return n
+}
+
+// mark returns the number of results per location, see rollback.
+func (c resultColumns) mark() map[int]int {
+	m := make(map[int]int, len(c))
+
+	for locationID, lr := range c {
+		m[locationID] = len(lr.times)
+	}
+
+	return m
+}
+
+// rollback removes all results added since mark was called.
+func (c resultColumns) rollback(m map[int]int) {
+	for locationID, lr := range c {
+		n, ok := m[locationID]
+		if !ok {
+			delete(c, locationID)
+
+			continue
+		}
+
+		lr.times = lr.times[:n]
+		lr.responseTimes = lr.responseTimes[:n]
+		lr.statuses = lr.statuses[:n]
+	}
+}
+
+// appendColumns appends the results of o.
+func (c resultColumns) appendColumns(o resultColumns) {
+	for locationID, from := range o {
+		lr, ok := c[locationID]
+		if !ok {
+			lr = &locationResults{}
+			c[locationID] = lr
+		}
+
+		lr.times = append(lr.times, from.times...)
+		lr.responseTimes = append(lr.responseTimes, from.responseTimes...)
+		lr.statuses = append(lr.statuses, from.statuses...)
+	}
+}
+
+// inRange returns a copy of the results in [from, to).
+func (c resultColumns) inRange(from, to time.Time) resultColumns {
+	filtered := make(resultColumns)
+
+	for locationID, lr := range c {
+		out := &locationResults{}
+
+		for i, t := range lr.times {
+			if t.Before(from) || !t.Before(to) {
+				continue
+			}
+
+			out.times = append(out.times, t)
+			out.responseTimes = append(out.responseTimes, lr.responseTimes[i])
+			out.statuses = append(out.statuses, lr.statuses[i])
+		}
+
+		if len(out.times) > 0 {
+			filtered[locationID] = out
+		}
+	}
+
+	return filtered
+}
+
+// monitorResultsPage is a page of the monitorResults endpoint, decoded as a
+// stream into columns.
+type monitorResultsPage struct {
+	columns           resultColumns
+	items             int
+	continuationToken string
+}
+
+func (p *monitorResultsPage) nextToken() string {
+	return p.continuationToken
+}
+
+func (p *monitorResultsPage) itemCount() int {
+	return p.items
+}
+
+// decodeStream decodes the page into the columns. If decoding fails, the
+// results of the page are removed again so that the request can be retried.
+func (p *monitorResultsPage) decodeStream(r io.Reader) error {
+	m := p.columns.mark()
+
+	p.items = 0
+	p.continuationToken = ""
+
+	if err := p.decode(json.NewDecoder(r)); err != nil {
+		p.columns.rollback(m)
+		p.items = 0
+
+		return err
+	}
+
+	return nil
+}
+
+func (p *monitorResultsPage) decode(dec *json.Decoder) error {
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		switch tok {
+		case "monitorResults":
+			if err := p.decodeResults(dec); err != nil {
+				return err
+			}
+		case "continuationToken":
+			if err := dec.Decode(&p.continuationToken); err != nil {
+				return err
+			}
+		default:
+			var skip json.RawMessage
+
+			if err := dec.Decode(&skip); err != nil {
+				return err
+			}
+		}
+	}
+
+	return expectDelim(dec, '}')
+}
+
+func (p *monitorResultsPage) decodeResults(dec *json.Decoder) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	if tok == nil {
+		return nil
+	}
+
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("monitorResults: expected array, got %v", tok)
+	}
+
+	for dec.More() {
+		var mr monitorResult
+
+		if err := dec.Decode(&mr); err != nil {
+			return err
+		}
+
+		p.columns.add(&mr)
+		p.items++
+	}
+
+	return expectDelim(dec, ']')
+}
+
+// expectDelim reads the next token and fails if it isn't delim.
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	if d, ok := tok.(json.Delim); !ok || d != delim {
+		return fmt.Errorf("expected '%v', got %v", delim, tok)
+	}
+
+	return nil
+}
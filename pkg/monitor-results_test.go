@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+// monitorResultsPayload generates a monitorResults page with n results spread
+// over 10 locations.
+func monitorResultsPayload(n int) []byte {
+	var buf bytes.Buffer
+
+	start := time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC)
+
+	buf.WriteString(`{"monitorResults":[`)
+
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		fmt.Fprintf(&buf, `{"locationId":%d,"time":"%s","status":"Ok","responseTimeMs":%d}`,
+			i%10, start.Add(time.Duration(i)*time.Second).Format(time.RFC3339), 100+i%250)
+	}
+
+	buf.WriteString(`],"continuationToken":"next"}`)
+
+	return buf.Bytes()
+}
+
+// decodeBuffered is the former decoding path, which read the whole body and
+// unmarshalled it into a slice before building the columns.
+func decodeBuffered(r io.Reader) (resultColumns, string, error) {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var page struct {
+		MonitorResults    []monitorResult `json:"monitorResults"`
+		ContinuationToken string          `json:"continuationToken"`
+	}
+
+	if err := json.Unmarshal(body, &page); err != nil {
+		return nil, "", err
+	}
+
+	columns := make(resultColumns)
+
+	for i := range page.MonitorResults {
+		columns.add(&page.MonitorResults[i])
+	}
+
+	return columns, page.ContinuationToken, nil
+}
+
+func TestMonitorResultsPageDecodeStream(t *testing.T) {
+	payload := monitorResultsPayload(1000)
+
+	page := &monitorResultsPage{columns: make(resultColumns)}
+	if err := page.decodeStream(bytes.NewReader(payload)); err != nil {
+		t.Fatalf("decodeStream: %v", err)
+	}
+
+	buffered, token, err := decodeBuffered(bytes.NewReader(payload))
+	if err != nil {
+		t.Fatalf("decodeBuffered: %v", err)
+	}
+
+	if page.itemCount() != 1000 || page.columns.len() != 1000 || page.nextToken() != token {
+		t.Errorf("items = %d, columns = %d, token = %q", page.itemCount(), page.columns.len(), page.nextToken())
+	}
+
+	for locationID, lr := range buffered {
+		got, ok := page.columns[locationID]
+		if !ok || len(got.times) != len(lr.times) || got.responseTimes[0] != lr.responseTimes[0] {
+			t.Errorf("location %d differs from the buffered decoding", locationID)
+		}
+	}
+
+	// A truncated page leaves the columns unchanged
+	truncated := &monitorResultsPage{columns: page.columns}
+	if err := truncated.decodeStream(bytes.NewReader(payload[:len(payload)/2])); err == nil {
+		t.Fatal("decodeStream of a truncated page succeeded")
+	}
+
+	if page.columns.len() != 1000 || truncated.itemCount() != 0 {
+		t.Errorf("columns = %d, items = %d after a failed page", page.columns.len(), truncated.itemCount())
+	}
+}
+
+func benchmarkMonitorResults(b *testing.B, decode func(io.Reader) error) {
+	for _, n := range []int{10000, 100000} {
+		payload := monitorResultsPayload(n)
+
+		b.Run(fmt.Sprintf("results=%d", n), func(b *testing.B) {
+			b.SetBytes(int64(len(payload)))
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				if err := decode(bytes.NewReader(payload)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkMonitorResultsStream(b *testing.B) {
+	benchmarkMonitorResults(b, func(r io.Reader) error {
+		page := &monitorResultsPage{columns: make(resultColumns)}
+
+		return page.decodeStream(r)
+	})
+}
+
+func BenchmarkMonitorResultsBuffered(b *testing.B) {
+	benchmarkMonitorResults(b, func(r io.Reader) error {
+		_, _, err := decodeBuffered(r)
+
+		return err
+	})
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// monitorResultSet are the results of one monitor.
+type monitorResultSet struct {
+	monitor monitor
+	results resultColumns
+}
+
+// selectsMultipleMonitors returns whether the query may select more than one monitor.
+func (qm *queryModel) selectsMultipleMonitors() bool {
+	return len(qm.MonitorIDs) > 0 || qm.MonitorNameRegex != "" || qm.MonitorType != ""
+}
+
+// resolveMonitors returns the monitors selected by the query model. The
+// selected IDs, or all monitors if no IDs are selected, are filtered by the
+// name regex and the monitor type.
+func (s *instanceSettings) resolveMonitors(ctx context.Context, qm *queryModel, apiToken string) ([]monitor, error) {
+	ids := make([]string, 0, len(qm.MonitorIDs)+1)
+
+	if qm.MonitorID != "" {
+		ids = append(ids, qm.MonitorID)
+	}
+
+	for _, id := range qm.MonitorIDs {
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+
+	if len(ids) == 0 && !qm.selectsMultipleMonitors() {
+		log.DefaultLogger.Error("MonitorID is empty")
+
+		return nil, errors.New("invalid monitor id")
+	}
+
+	var nameRegex *regexp.Regexp
+
+	if qm.MonitorNameRegex != "" {
+		var err error
+
+		nameRegex, err = regexp.Compile(qm.MonitorNameRegex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid monitor name regex: %w", err)
+		}
+	}
+
+	monitors, err := s.getMonitors(ctx, apiToken)
+	if err != nil {
+		// The names are only needed for display if the monitors are selected by ID
+		if nameRegex != nil || qm.MonitorType != "" {
+			return nil, fmt.Errorf("get monitors failed: %w", err)
+		}
+
+		log.DefaultLogger.Warn("get monitors failed: ", err.Error())
+	}
+
+	candidates := monitors
+
+	if len(ids) > 0 {
+		monitorsMap := make(map[string]monitor)
+
+		for _, m := range monitors {
+			monitorsMap[m.MonitorID] = m
+		}
+
+		candidates = make([]monitor, 0, len(ids))
+		seen := make(map[string]bool)
+
+		for _, id := range ids {
+			if seen[id] {
+				continue
+			}
+
+			seen[id] = true
+
+			m, ok := monitorsMap[id]
+			if !ok {
+				m = monitor{MonitorID: id, Name: id}
+			}
+
+			candidates = append(candidates, m)
+		}
+	}
+
+	selected := make([]monitor, 0, len(candidates))
+
+	for _, m := range candidates {
+		if nameRegex != nil && !nameRegex.MatchString(m.Name) {
+			continue
+		}
+
+		if qm.MonitorType != "" && !strings.EqualFold(m.MonitorType, qm.MonitorType) {
+			continue
+		}
+
+		selected = append(selected, m)
+	}
+
+	log.DefaultLogger.Debug(fmt.Sprintf("Selected %d monitors", len(selected)))
+
+	return selected, nil
+}
+
+// getQueryMonitorResults returns the results of the monitors selected by the
+// query in its time range, requested concurrently and restricted to the
+// selected locations, and the location metadata.
+func (s *instanceSettings) getQueryMonitorResults(ctx context.Context, query *backend.DataQuery, qm *queryModel,
+	apiToken string) ([]monitorResultSet, locationIndex, error) {
+	monitors, err := s.resolveMonitors(ctx, qm, apiToken)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	locations, err := s.getLocations(ctx, apiToken)
+	if err != nil {
+		log.DefaultLogger.Error("getLocations: ", err.Error())
+
+		return nil, nil, fmt.Errorf("get locations failed: %w", err)
+	}
+
+	sets := make([]monitorResultSet, len(monitors))
+	errs := make([]error, len(monitors))
+	workers := make(chan struct{}, s.settings.maxConcurrentQueries())
+
+	var wg sync.WaitGroup
+
+	for i := range monitors {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			workers <- struct{}{}
+			defer func() { <-workers }()
+
+			sets[i].monitor = monitors[i]
+			sets[i].results, errs[i] = s.getMonitorResults(ctx, apiToken, monitors[i].MonitorID,
+				query.TimeRange.From, query.TimeRange.To)
+		}(i)
+	}
+
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			log.DefaultLogger.Error("getMonitorResults: ", err.Error())
+
+			return nil, nil, fmt.Errorf("get monitor results of '%s' failed: %w", monitors[i].Name, err)
+		}
+	}
+
+	index := newLocationIndex(locations)
+
+	for i := range sets {
+		sets[i].results = index.filter(sets[i].results, qm.Locations)
+	}
+
+	return sets, index, nil
+}
+
+// seriesName returns the name of a series of a location, prefixed with the
+// monitor name if the query may select multiple monitors.
+func seriesName(qm *queryModel, m *monitor, locationName string) string {
+	if !qm.selectsMultipleMonitors() {
+		return locationName
+	}
+
+	return m.Name + " - " + locationName
+}
+
+// monitorLabels returns the labels identifying the series of a monitor.
+func monitorLabels(m *monitor) data.Labels {
+	return data.Labels{
+		"monitor_id":   m.MonitorID,
+		"monitor_name": m.Name,
+	}
+}
+
+// seriesFrame returns the frame of a series, named by its display name, with
+// a value field of a stable name carrying the labels of the series.
+func seriesFrame(displayName string, times []time.Time, valueName string, labels data.Labels, values interface{},
+	config *data.FieldConfig) *data.Frame {
+	if config == nil {
+		config = &data.FieldConfig{}
+	}
+
+	config.DisplayNameFromDS = displayName
+
+	return data.NewFrame(displayName,
+		data.NewField("time", nil, times),
+		data.NewField(valueName, labels, values).SetConfig(config),
+	)
+}
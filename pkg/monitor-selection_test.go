@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestResolveMonitors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != defaultMonitorsPath {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		_, _ = io.WriteString(w, `{"monitors":[
+			{"monitorId":"1","type":"Https","name":"Shop"},
+			{"monitorId":"2","type":"Https","name":"Shop API"},
+			{"monitorId":"3","type":"Icmp","name":"Shop Gateway"},
+			{"monitorId":"4","type":"Https","name":"Blog"}
+		]}`)
+	}))
+	defer server.Close()
+
+	inst := newTestDatasourceInstance(t, server.URL, nil)
+
+	tests := []struct {
+		name string
+		qm   queryModel
+		want []string
+	}{
+		{"monitor", queryModel{MonitorID: "4"}, []string{"4"}},
+		{"monitor and IDs", queryModel{MonitorID: "4", MonitorIDs: []string{"1", "4"}}, []string{"4", "1"}},
+		// Without a selected monitor the filters apply to all monitors
+		{"regex", queryModel{MonitorNameRegex: "^Shop"}, []string{"1", "2", "3"}},
+		{"regex and type", queryModel{MonitorNameRegex: "^Shop", MonitorType: "https"}, []string{"1", "2"}},
+		// With a selected monitor the filters only apply to the selected monitors
+		{"monitor and regex", queryModel{MonitorID: "2", MonitorNameRegex: "^Shop"}, []string{"2"}},
+		{"monitor not matching", queryModel{MonitorID: "4", MonitorNameRegex: "^Shop"}, []string{}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			monitors, err := inst.resolveMonitors(context.Background(), &tt.qm, "token")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			ids := make([]string, 0, len(monitors))
+			for _, m := range monitors {
+				ids = append(ids, m.MonitorID)
+			}
+
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("monitors = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+
+	if _, err := inst.resolveMonitors(context.Background(), &queryModel{}, "token"); err == nil {
+		t.Error("resolveMonitors without a selection succeeded")
+	}
+}
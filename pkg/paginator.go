@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// apiPage is a page of a paginated API response.
+type apiPage interface {
+	// nextToken returns the continuation token of the next page, empty on the last page
+	nextToken() string
+	// itemCount returns the number of items of the page
+	itemCount() int
+}
+
+// streamingPage is an apiPage decoded from the response stream instead of a
+// buffered response body. decodeStream is called again if a request is
+// retried, it has to discard the items decoded if it fails.
+type streamingPage interface {
+	apiPage
+	decodeStream(r io.Reader) error
+}
+
+// paginator streams the pages of a paginated API endpoint, following the
+// continuation tokens. The pages are only requested when calling Next, so
+// callers can stop early by not calling it anymore.
+type paginator struct {
+	s        *instanceSettings
+	name     string
+	endpoint string
+	apiToken string
+	params   url.Values
+
+	token string
+	seen  map[string]bool
+	pages int
+	items int
+	done  bool
+}
+
+// newPaginator returns a paginator for endpoint, name is used for logging.
+func (s *instanceSettings) newPaginator(name, endpoint, apiToken string, params url.Values) *paginator {
+	if params == nil {
+		params = url.Values{}
+	}
+
+	return &paginator{
+		s:        s,
+		name:     name,
+		endpoint: endpoint,
+		apiToken: apiToken,
+		params:   params,
+		seen:     make(map[string]bool),
+	}
+}
+
+// HasNext returns whether there is another page.
+func (p *paginator) HasNext() bool {
+	return !p.done
+}
+
+// Next requests the next page and decodes it into page. It fails if the
+// maximum number of pages or items is exceeded, or if the API returns a
+// continuation token twice.
+func (p *paginator) Next(ctx context.Context, page apiPage) error {
+	if p.done {
+		return fmt.Errorf("%s: no more pages", p.name)
+	}
+
+	if p.pages >= p.s.settings.maxPages() {
+		return fmt.Errorf("%s: more than %d pages", p.name, p.s.settings.maxPages())
+	}
+
+	u, err := url.Parse(p.s.settings.apiURL(p.endpoint))
+	if err != nil {
+		log.DefaultLogger.Error("Couldn't parse API call: ", err.Error())
+
+		return fmt.Errorf("couldn't parse API call: %w", err)
+	}
+
+	q := u.Query()
+
+	for key, values := range p.params {
+		for _, v := range values {
+			q.Add(key, v)
+		}
+	}
+
+	if p.token != "" {
+		q.Set("continuationToken", p.token)
+	}
+
+	u.RawQuery = q.Encode()
+
+	log.DefaultLogger.Debug(fmt.Sprintf("Requesting %s, Page: %d, ContinuationToken: %v", p.name, p.pages+1, p.token))
+
+	if sp, ok := page.(streamingPage); ok {
+		if err := p.s.doWebMonitoringAPIStream(ctx, u.String(), p.apiToken, sp.decodeStream); err != nil {
+			log.DefaultLogger.Error(err.Error())
+
+			return err
+		}
+	} else {
+		body, err := p.s.doWebMonitoringAPIQuery(ctx, u.String(), p.apiToken)
+		if err != nil {
+			log.DefaultLogger.Error(err.Error())
+
+			return err
+		}
+
+		if err := json.Unmarshal(body, page); err != nil {
+			log.DefaultLogger.Error("json unmarshall: ", err.Error())
+
+			return newDecodeError(err)
+		}
+	}
+
+	p.pages++
+	p.items += page.itemCount()
+
+	log.DefaultLogger.Debug(fmt.Sprintf("Received %s, Page: %d, Items: %d, Total: %d, ContinuationToken: %v",
+		p.name, p.pages, page.itemCount(), p.items, page.nextToken()))
+
+	if p.items > p.s.settings.maxItems() {
+		return fmt.Errorf("%s: more than %d items", p.name, p.s.settings.maxItems())
+	}
+
+	return p.advance(page.nextToken())
+}
+
+// advance moves to the page of the continuation token.
+func (p *paginator) advance(token string) error {
+	if token == "" {
+		p.done = true
+
+		return nil
+	}
+
+	if p.seen[token] {
+		p.done = true
+
+		return fmt.Errorf("%s: continuation token repeated after %d pages", p.name, p.pages)
+	}
+
+	p.seen[token] = true
+	p.token = token
+
+	return nil
+}
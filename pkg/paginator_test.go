@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// pagesServer serves monitors pages of two monitors each, nextToken returns
+// the continuation token following the requested one.
+func pagesServer(requests *int32, nextToken func(token string) string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(requests, 1)
+
+		fmt.Fprintf(w, `{"monitors":[{"monitorId":"%d-1"},{"monitorId":"%d-2"}],"continuationToken":"%s"}`,
+			n, n, nextToken(r.URL.Query().Get("continuationToken")))
+	}))
+}
+
+func TestPaginator(t *testing.T) {
+	tests := []struct {
+		name      string
+		jsonData  map[string]interface{}
+		nextToken func(token string) string
+		requests  int32
+		monitors  int
+		err       string
+	}{
+		{
+			name: "last page",
+			nextToken: func(token string) string {
+				return map[string]string{"": "a", "a": "b", "b": ""}[token]
+			},
+			requests: 3,
+			monitors: 6,
+		},
+		{
+			name:      "repeated token",
+			nextToken: func(token string) string { return "a" },
+			requests:  2,
+			err:       "continuation token repeated after 2 pages",
+		},
+		{
+			name: "token cycle",
+			nextToken: func(token string) string {
+				return map[string]string{"": "a", "a": "b", "b": "a"}[token]
+			},
+			requests: 3,
+			err:      "continuation token repeated after 3 pages",
+		},
+		{
+			name:      "max pages",
+			jsonData:  map[string]interface{}{"maxPages": 3},
+			nextToken: func(token string) string { return token + "x" },
+			requests:  3,
+			err:       "more than 3 pages",
+		},
+		{
+			name:      "max items",
+			jsonData:  map[string]interface{}{"maxItems": 5},
+			nextToken: func(token string) string { return token + "x" },
+			requests:  3,
+			err:       "more than 5 items",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int32
+
+			server := pagesServer(&requests, tt.nextToken)
+			defer server.Close()
+
+			inst := newTestDatasourceInstance(t, server.URL, tt.jsonData)
+
+			monitors, err := inst.requestMonitors(context.Background(), "token")
+
+			switch {
+			case tt.err == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Fatalf("error = %v, want %q", err, tt.err)
+			}
+
+			if n := atomic.LoadInt32(&requests); n != tt.requests {
+				t.Errorf("%d requests, want %d", n, tt.requests)
+			}
+
+			if len(monitors) != tt.monitors {
+				t.Errorf("%d monitors, want %d", len(monitors), tt.monitors)
+			}
+		})
+	}
+}
+
+func TestPaginatorDone(t *testing.T) {
+	var requests int32
+
+	server := pagesServer(&requests, func(token string) string { return "" })
+	defer server.Close()
+
+	inst := newTestDatasourceInstance(t, server.URL, nil)
+	p := inst.newPaginator("monitors", inst.settings.Endpoints.Monitors, "token", nil)
+
+	var page monitorsResponse
+
+	if err := p.Next(context.Background(), &page); err != nil || p.HasNext() {
+		t.Fatalf("error = %v, HasNext = %v after the last page", err, p.HasNext())
+	}
+
+	if err := p.Next(context.Background(), &page); err == nil {
+		t.Error("Next after the last page succeeded")
+	}
+
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("%d requests, want 1", n)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// rateLimiter is a token bucket limiting the API requests of a datasource
+// instance. A nil rateLimiter doesn't limit.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns a limiter allowing rate requests per second with
+// bursts of up to burst requests, or nil if rate is not positive.
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &rateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks until a request may be sent and returns the time waited. It
+// fails without waiting if the context deadline would be exceeded.
+func (l *rateLimiter) Wait(ctx context.Context) (time.Duration, error) {
+	if l == nil {
+		return 0, nil
+	}
+
+	delay := l.reserve()
+	if delay == 0 {
+		return 0, nil
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+		l.cancel()
+
+		return 0, fmt.Errorf("rate limit wait of %s exceeds the request deadline", delay)
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		l.cancel()
+
+		return 0, ctx.Err()
+	case <-timer.C:
+		return delay, nil
+	}
+}
+
+// reserve takes a token and returns how long to wait until it is available.
+func (l *rateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+
+	l.last = now
+	l.tokens--
+
+	if l.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// cancel returns a reserved token that was not used.
+func (l *rateLimiter) cancel() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.tokens++
+}
+
+type rateLimitWaitKey struct{}
+
+// withRateLimitWait returns a context recording the time spent waiting for
+// the rate limiter, see rateLimitWaited.
+func withRateLimitWait(ctx context.Context) context.Context {
+	return context.WithValue(ctx, rateLimitWaitKey{}, new(int64))
+}
+
+// addRateLimitWait adds the time waited to the context, if it is recorded.
+func addRateLimitWait(ctx context.Context, waited time.Duration) {
+	if total, ok := ctx.Value(rateLimitWaitKey{}).(*int64); ok {
+		atomic.AddInt64(total, int64(waited))
+	}
+}
+
+// rateLimitWaited returns the total time waited for the rate limiter.
+func rateLimitWaited(ctx context.Context) time.Duration {
+	if total, ok := ctx.Value(rateLimitWaitKey{}).(*int64); ok {
+		return time.Duration(atomic.LoadInt64(total))
+	}
+
+	return 0
+}
+
+// rateLimitNotice returns the frame notice about the time waited.
+func rateLimitNotice(waited time.Duration) data.Notice {
+	return data.Notice{
+		Severity: data.NoticeSeverityInfo,
+		Text:     fmt.Sprintf("Waited %s for the API rate limit", waited.Round(time.Millisecond)),
+	}
+}
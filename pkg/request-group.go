@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// inflightCall is a request that is in progress or completed, dups is the
+// number of callers that joined it.
+type inflightCall struct {
+	done chan struct{}
+	dups int
+	val  interface{}
+	err  error
+}
+
+// requestGroup coalesces identical concurrent API requests, so that only one
+// upstream request runs and all callers share its decoded result and error.
+type requestGroup struct {
+	mu    sync.Mutex
+	calls map[string]*inflightCall
+}
+
+func newRequestGroup() *requestGroup {
+	return &requestGroup{
+		calls: make(map[string]*inflightCall),
+	}
+}
+
+// Do runs fn, unless a call with the same key is already in flight, in which
+// case it waits for that call and returns its result. The result is shared
+// between the callers and must not be modified.
+//
+// fn runs with a context that is detached from the cancellation of the caller
+// starting it and bounded by timeout instead, so that canceling one caller
+// doesn't fail the others. Every caller stops waiting when its own ctx is done.
+func (g *requestGroup) Do(ctx context.Context, key string, timeout time.Duration,
+	fn func(ctx context.Context) (interface{}, error)) (val interface{}, shared bool, err error) {
+	g.mu.Lock()
+
+	c, shared := g.calls[key]
+	if shared {
+		c.dups++
+	} else {
+		c = &inflightCall{done: make(chan struct{})}
+		g.calls[key] = c
+
+		go g.run(detachedContext{ctx}, key, timeout, c, fn)
+	}
+
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.val, shared, c.err
+	case <-ctx.Done():
+		return nil, shared, &apiError{Kind: errTimeout, Err: ctx.Err()}
+	}
+}
+
+func (g *requestGroup) run(ctx context.Context, key string, timeout time.Duration, c *inflightCall,
+	fn func(ctx context.Context) (interface{}, error)) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+
+	defer func() {
+		if r := recover(); r != nil {
+			log.DefaultLogger.Error(fmt.Sprintf("request %s panicked: %v\n%s", key, r, debug.Stack()))
+
+			c.val, c.err = nil, fmt.Errorf("request panicked: %v", r)
+		}
+
+		cancel()
+
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+
+		close(c.done)
+	}()
+
+	c.val, c.err = fn(ctx)
+}
+
+// detachedContext keeps the values of its parent, but not its deadline and
+// cancellation.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+func (detachedContext) Done() <-chan struct{} { return nil }
+
+func (detachedContext) Err() error { return nil }
+
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
+
+// requestKey returns the key of a request to endpoint with the given
+// parameters. The API token is hashed to keep it out of the key.
+func requestKey(endpoint, apiToken string, params ...string) string {
+	token := sha256.Sum256([]byte(apiToken))
+
+	return endpoint + "|" + hex.EncodeToString(token[:]) + "|" + strings.Join(params, "|")
+}
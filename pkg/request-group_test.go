@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitForCall waits until the call of key is in flight with dups callers
+// joined.
+func waitForCall(g *requestGroup, key string, dups int) {
+	for {
+		g.mu.Lock()
+		c, ok := g.calls[key]
+		joined := ok && c.dups == dups
+		g.mu.Unlock()
+
+		if joined {
+			return
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRequestGroupShared(t *testing.T) {
+	g := newRequestGroup()
+	release := make(chan struct{})
+
+	var calls int32
+
+	fn := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+
+		return "result", nil
+	}
+
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	leader := make(chan error, 1)
+
+	go func() {
+		_, _, err := g.Do(leaderCtx, "key", time.Minute, fn)
+		leader <- err
+	}()
+
+	waitForCall(g, "key", 0)
+
+	type result struct {
+		v      interface{}
+		shared bool
+		err    error
+	}
+
+	waiter := make(chan result, 1)
+
+	go func() {
+		v, shared, err := g.Do(context.Background(), "key", time.Minute, fn)
+		waiter <- result{v, shared, err}
+	}()
+
+	waitForCall(g, "key", 1)
+
+	// Canceling the leader doesn't fail the waiter
+	cancelLeader()
+
+	if err := <-leader; !errors.Is(err, errTimeout) {
+		t.Errorf("leader error = %v, want %v", err, errTimeout)
+	}
+
+	close(release)
+
+	if r := <-waiter; r.err != nil || !r.shared || r.v != "result" {
+		t.Errorf("waiter: result = %v, shared = %v, error = %v", r.v, r.shared, r.err)
+	}
+
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("%d calls, want 1", n)
+	}
+}
+
+func TestRequestGroupWaiterCanceled(t *testing.T) {
+	g := newRequestGroup()
+	release := make(chan struct{})
+	defer close(release)
+
+	go func() {
+		_, _, _ = g.Do(context.Background(), "key", time.Minute, func(ctx context.Context) (interface{}, error) {
+			<-release
+
+			return nil, nil
+		})
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, _, err := g.Do(ctx, "key", time.Minute, func(ctx context.Context) (interface{}, error) {
+		<-release
+
+		return nil, nil
+	})
+	if !errors.Is(err, errTimeout) {
+		t.Errorf("error = %v, want %v", err, errTimeout)
+	}
+}
+
+func TestRequestGroupTimeout(t *testing.T) {
+	g := newRequestGroup()
+
+	_, _, err := g.Do(context.Background(), "key", 10*time.Millisecond, func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+
+		return nil, ctx.Err()
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestRequestGroupPanic(t *testing.T) {
+	g := newRequestGroup()
+
+	v, _, err := g.Do(context.Background(), "key", time.Minute, func(ctx context.Context) (interface{}, error) {
+		panic("decode failed")
+	})
+	if err == nil || v != nil {
+		t.Errorf("result = %v, error = %v, want an error", v, err)
+	}
+
+	if len(g.calls) != 0 {
+		t.Errorf("%d calls left in flight", len(g.calls))
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// resultsSettleTime is how long after its end a bucket is considered
+// immutable. Results may arrive with a small delay at the API.
+const resultsSettleTime = 5 * time.Minute
+
+type resultsBucketKey struct {
+	monitorID string
+	start     int64
+}
+
+type resultsBucket struct {
+	key     resultsBucketKey
+	results resultColumns
+}
+
+// resultsCache caches the monitor results of closed time buckets, evicting
+// the least recently used buckets once more than maxResults are stored.
+type resultsCache struct {
+	bucketSize time.Duration
+	maxResults int
+
+	mu      sync.Mutex
+	size    int
+	lru     *list.List
+	buckets map[resultsBucketKey]*list.Element
+
+	hits   int64
+	misses int64
+}
+
+// resultsCacheStats are the counters of the results cache.
+type resultsCacheStats struct {
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+	Buckets int   `json:"buckets"`
+	Results int   `json:"results"`
+}
+
+// newResultsCache returns a cache with the given bucket size, or nil if the
+// cache is disabled by a maxResults that is not positive.
+func newResultsCache(bucketSize time.Duration, maxResults int) *resultsCache {
+	if maxResults <= 0 {
+		return nil
+	}
+
+	return &resultsCache{
+		bucketSize: bucketSize,
+		maxResults: maxResults,
+		lru:        list.New(),
+		buckets:    make(map[resultsBucketKey]*list.Element),
+	}
+}
+
+func (c *resultsCache) get(key resultsBucketKey) (resultColumns, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.buckets[key]
+	if !ok {
+		atomic.AddInt64(&c.misses, 1)
+
+		return nil, false
+	}
+
+	atomic.AddInt64(&c.hits, 1)
+	c.lru.MoveToFront(e)
+
+	return e.Value.(*resultsBucket).results, true
+}
+
+func (c *resultsCache) put(key resultsBucketKey, results resultColumns) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.buckets[key]; ok {
+		c.size -= e.Value.(*resultsBucket).results.len()
+		c.lru.Remove(e)
+		delete(c.buckets, key)
+	}
+
+	size := results.len()
+	if size > c.maxResults {
+		return
+	}
+
+	c.buckets[key] = c.lru.PushFront(&resultsBucket{key: key, results: results})
+	c.size += size
+
+	for c.size > c.maxResults {
+		oldest := c.lru.Back()
+		bucket := oldest.Value.(*resultsBucket)
+
+		c.lru.Remove(oldest)
+		delete(c.buckets, bucket.key)
+		c.size -= bucket.results.len()
+	}
+}
+
+// Flush removes all buckets and returns how many were removed.
+func (c *resultsCache) Flush() int {
+	if c == nil {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := len(c.buckets)
+
+	c.lru.Init()
+	c.buckets = make(map[resultsBucketKey]*list.Element)
+	c.size = 0
+
+	return n
+}
+
+// Stats returns the hit and miss counters and the cache size.
+func (c *resultsCache) Stats() resultsCacheStats {
+	if c == nil {
+		return resultsCacheStats{}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return resultsCacheStats{
+		Hits:    atomic.LoadInt64(&c.hits),
+		Misses:  atomic.LoadInt64(&c.misses),
+		Buckets: len(c.buckets),
+		Results: c.size,
+	}
+}
+
+// getMonitorResults returns the monitor results in [timeFrom, timeTo]. Closed
+// time buckets are served from the results cache, only missing buckets and
+// the recent, still open buckets are requested from the API.
+func (s *instanceSettings) getMonitorResults(ctx context.Context, apiToken, monitorID string,
+	timeFrom, timeTo time.Time) (resultColumns, error) {
+	c := s.resultsCache
+	if c == nil {
+		return s.requestMonitorResultsOnce(ctx, apiToken, monitorID, timeFrom, timeTo)
+	}
+
+	closedUntil := time.Now().Add(-resultsSettleTime).Truncate(c.bucketSize)
+	result := make(resultColumns)
+
+	var missingFrom time.Time
+
+	// fetchMissing requests the buckets in [missingFrom, until) and caches them
+	fetchMissing := func(until time.Time) error {
+		if missingFrom.IsZero() {
+			return nil
+		}
+
+		results, err := s.requestMonitorResultsOnce(ctx, apiToken, monitorID, missingFrom, until)
+		if err != nil {
+			return err
+		}
+
+		for start := missingFrom; start.Before(until); start = start.Add(c.bucketSize) {
+			bucket := results.inRange(start, start.Add(c.bucketSize))
+
+			c.put(resultsBucketKey{monitorID: monitorID, start: start.Unix()}, bucket)
+			result.appendColumns(bucket)
+		}
+
+		missingFrom = time.Time{}
+
+		return nil
+	}
+
+	start := timeFrom.Truncate(c.bucketSize)
+
+	for ; start.Before(closedUntil) && !start.After(timeTo); start = start.Add(c.bucketSize) {
+		bucket, ok := c.get(resultsBucketKey{monitorID: monitorID, start: start.Unix()})
+		if !ok {
+			if missingFrom.IsZero() {
+				missingFrom = start
+			}
+
+			continue
+		}
+
+		if err := fetchMissing(start); err != nil {
+			return nil, err
+		}
+
+		result.appendColumns(bucket)
+	}
+
+	if err := fetchMissing(start); err != nil {
+		return nil, err
+	}
+
+	// The open buckets are never cached
+	if !start.After(timeTo) {
+		results, err := s.requestMonitorResultsOnce(ctx, apiToken, monitorID, start, timeTo)
+		if err != nil {
+			return nil, err
+		}
+
+		result.appendColumns(results)
+	}
+
+	stats := c.Stats()
+
+	log.DefaultLogger.Debug(fmt.Sprintf("Results cache, Hits: %d, Misses: %d, Buckets: %d, Results: %d",
+		stats.Hits, stats.Misses, stats.Buckets, stats.Results))
+
+	return result.inRange(timeFrom, timeTo.Add(time.Nanosecond)), nil
+}
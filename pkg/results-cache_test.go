@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// resultsServer serves a monitor result every 10 minutes within the requested
+// range, including its end, and records the requested ranges.
+type resultsServer struct {
+	mu       sync.Mutex
+	requests []string
+}
+
+func (rs *resultsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start, errStart := time.Parse(time.RFC3339, r.URL.Query().Get("start"))
+	end, errEnd := time.Parse(time.RFC3339, r.URL.Query().Get("end"))
+
+	if errStart != nil || errEnd != nil {
+		http.Error(w, "invalid range", http.StatusBadRequest)
+
+		return
+	}
+
+	rs.mu.Lock()
+	rs.requests = append(rs.requests, fmt.Sprintf("%s/%s", start.Format("15:04"), end.Format("15:04")))
+	rs.mu.Unlock()
+
+	results := make([]string, 0)
+
+	for t := firstResultTime(start); !t.After(end); t = t.Add(10 * time.Minute) {
+		results = append(results, fmt.Sprintf(`{"locationId":1,"time":"%s","status":"Ok","responseTimeMs":100}`,
+			t.Format(time.RFC3339)))
+	}
+
+	_, _ = io.WriteString(w, `{"monitorResults":[`+strings.Join(results, ",")+`]}`)
+}
+
+// takeRequests returns the ranges requested since the last call.
+func (rs *resultsServer) takeRequests() []string {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	requests := rs.requests
+	rs.requests = nil
+
+	return requests
+}
+
+// firstResultTime returns the time of the first result at or after t.
+func firstResultTime(t time.Time) time.Time {
+	first := t.Truncate(10 * time.Minute)
+	if first.Before(t) {
+		first = first.Add(10 * time.Minute)
+	}
+
+	return first
+}
+
+func TestGetMonitorResultsBuckets(t *testing.T) {
+	rs := &resultsServer{}
+
+	server := httptest.NewServer(rs)
+	defer server.Close()
+
+	inst := newTestDatasourceInstance(t, server.URL, map[string]interface{}{"resultsCacheBucket": 3600})
+
+	// Don't run across a change of the closed buckets
+	closedUntil := time.Now().UTC().Add(-resultsSettleTime).Truncate(time.Hour)
+	if wait := time.Until(closedUntil.Add(time.Hour + resultsSettleTime)); wait < 5*time.Second {
+		time.Sleep(wait + time.Second)
+
+		closedUntil = closedUntil.Add(time.Hour)
+	}
+
+	now := time.Now().UTC()
+	first, second, third := closedUntil.Add(-3*time.Hour), closedUntil.Add(-2*time.Hour), closedUntil.Add(-time.Hour)
+	hm := func(t time.Time) string { return t.Format("15:04") }
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		requests []string
+	}{
+		// A single closed bucket is requested and cached, without open buckets
+		{"second bucket", second.Add(10 * time.Minute), second.Add(30 * time.Minute),
+			[]string{hm(second) + "/" + hm(third)}},
+		// The missing buckets around the cached one are requested, the open buckets always
+		{"first refresh", first.Add(15 * time.Minute), now, []string{
+			hm(first) + "/" + hm(second),
+			hm(third) + "/" + hm(closedUntil),
+			hm(closedUntil) + "/" + hm(now),
+		}},
+		{"second refresh", first.Add(15 * time.Minute), now, []string{hm(closedUntil) + "/" + hm(now)}},
+	}
+
+	for _, tt := range tests {
+		results, err := inst.getMonitorResults(context.Background(), "token", "1", tt.from, tt.to)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+
+		if requests := rs.takeRequests(); strings.Join(requests, " ") != strings.Join(tt.requests, " ") {
+			t.Errorf("%s: requests = %v, want %v", tt.name, requests, tt.requests)
+		}
+
+		// Every result within the range is returned once, in order
+		want := 0
+		for ts := firstResultTime(tt.from); !ts.After(tt.to); ts = ts.Add(10 * time.Minute) {
+			want++
+		}
+
+		times := results[1].times
+		if len(times) != want {
+			t.Errorf("%s: %d results, want %d", tt.name, len(times), want)
+
+			continue
+		}
+
+		for i := range times {
+			if times[i].Before(tt.from) || times[i].After(tt.to) || (i > 0 && !times[i].After(times[i-1])) {
+				t.Errorf("%s: result %d at %s out of range or order", tt.name, i, times[i])
+			}
+		}
+	}
+}
+
+// resultsOfSize returns n results of one location.
+func resultsOfSize(n int) resultColumns {
+	return resultColumns{1: &locationResults{
+		times:         make([]time.Time, n),
+		responseTimes: make([]int32, n),
+		statuses:      make([]string, n),
+	}}
+}
+
+func TestResultsCachePutEviction(t *testing.T) {
+	c := newResultsCache(time.Hour, 10)
+
+	a, b, d := resultsBucketKey{"1", 0}, resultsBucketKey{"1", 3600}, resultsBucketKey{"1", 7200}
+
+	c.put(a, resultsOfSize(4))
+	c.put(b, resultsOfSize(4))
+
+	// a is now the most recently used bucket
+	if _, ok := c.get(a); !ok {
+		t.Fatal("bucket a missing")
+	}
+
+	c.put(d, resultsOfSize(4))
+
+	if _, ok := c.get(b); ok {
+		t.Error("least recently used bucket b not evicted")
+	}
+
+	if _, ok := c.get(a); !ok {
+		t.Error("bucket a evicted")
+	}
+
+	if stats := c.Stats(); stats.Buckets != 2 || stats.Results != 8 {
+		t.Errorf("stats = %+v, want 2 buckets with 8 results", stats)
+	}
+
+	// Replacing a bucket updates the size
+	c.put(a, resultsOfSize(1))
+
+	if stats := c.Stats(); stats.Buckets != 2 || stats.Results != 5 {
+		t.Errorf("stats = %+v, want 2 buckets with 5 results", stats)
+	}
+
+	// Buckets larger than the cache aren't stored
+	c.put(b, resultsOfSize(11))
+
+	if _, ok := c.get(b); ok {
+		t.Error("bucket larger than the cache stored")
+	}
+
+	if stats := c.Stats(); stats.Results != 5 {
+		t.Errorf("results = %d, want 5", stats.Results)
+	}
+}
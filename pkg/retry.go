@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// jitter is a seeded random source for the backoff jitter, math/rand's
+// global source is not seeded and therefore identical in every process.
+var jitter = struct {
+	sync.Mutex
+	*rand.Rand
+}{
+	Rand: rand.New(rand.NewSource(time.Now().UnixNano())), //nolint:gosec
+}
+
+// doWebMonitoringAPIStream does an API request, passes the response body to
+// decode and retries it on rate limiting, server errors and transient network
+// errors. The delay between the attempts grows exponentially with jitter,
+// unless the API sends a Retry-After header. Retries stop as soon as the next
+// attempt would exceed the context deadline.
+//
+// decode is called again for every attempt, so it has to discard everything
+// decoded if it fails.
+func (s *instanceSettings) doWebMonitoringAPIStream(ctx context.Context, queryURL, apiToken string,
+	decode func(io.Reader) error) error {
+	maxRetries := s.settings.maxRetries()
+
+	for attempt := 0; ; attempt++ {
+		err := s.doWebMonitoringAPIRequest(ctx, queryURL, apiToken, decode)
+		if err == nil {
+			return nil
+		}
+
+		if attempt >= maxRetries || !isRetryable(ctx, err) {
+			return err
+		}
+
+		delay, ok := s.retryDelay(attempt, err)
+		if !ok {
+			log.DefaultLogger.Debug(fmt.Sprintf("Not retrying %s, Retry-After %s exceeds the maximum retry delay %s",
+				queryURL, delay, s.settings.retryMaxDelay()))
+
+			return err
+		}
+
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			log.DefaultLogger.Debug(fmt.Sprintf("Not retrying %s, delay %s exceeds the request deadline", queryURL, delay))
+
+			return err
+		}
+
+		log.DefaultLogger.Debug(fmt.Sprintf("Attempt %d/%d for %s failed: %s, retrying in %s",
+			attempt+1, maxRetries+1, queryURL, err.Error(), delay))
+
+		timer := time.NewTimer(delay)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// retryDelay returns the delay before the next attempt, honoring Retry-After.
+// It returns false if Retry-After exceeds the maximum retry delay, waiting
+// less than requested would only be rate limited again.
+func (s *instanceSettings) retryDelay(attempt int, err error) (time.Duration, bool) {
+	var ae *apiError
+	if errors.As(err, &ae) && ae.RetryAfter > 0 {
+		return ae.RetryAfter, ae.RetryAfter <= s.settings.retryMaxDelay()
+	}
+
+	return backoff(attempt, s.settings.retryBaseDelay(), s.settings.retryMaxDelay()), true
+}
+
+// backoff returns a delay in [0, min(maxDelay, baseDelay*2^attempt)) ("full jitter").
+func backoff(attempt int, baseDelay, maxDelay time.Duration) time.Duration {
+	delay := maxDelay
+
+	if attempt < 32 && baseDelay<<uint(attempt) < maxDelay && baseDelay<<uint(attempt) > 0 {
+		delay = baseDelay << uint(attempt)
+	}
+
+	jitter.Lock()
+	defer jitter.Unlock()
+
+	return time.Duration(jitter.Int63n(int64(delay) + 1))
+}
+
+// isRetryable returns whether a failed request may succeed when repeated.
+func isRetryable(ctx context.Context, err error) bool {
+	// The request itself was canceled or timed out, another attempt is pointless
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var ae *apiError
+	if errors.As(err, &ae) && ae.StatusCode != 0 {
+		return ae.StatusCode == http.StatusTooManyRequests || ae.StatusCode >= http.StatusInternalServerError
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
+
+// parseRetryAfter parses the Retry-After header, which is either a number of
+// seconds or an HTTP date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+
+		return time.Duration(seconds) * time.Second
+	}
+
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+
+	return 0
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDoWebMonitoringAPIStreamRetryAfter(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter string
+		attempts   int32
+		err        error
+	}{
+		{"within the maximum delay", "0", 2, nil},
+		{"exceeding the maximum delay", "3600", 1, errRateLimited},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts int32
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&attempts, 1) == 1 {
+					w.Header().Set("Retry-After", tt.retryAfter)
+					w.WriteHeader(http.StatusTooManyRequests)
+
+					return
+				}
+
+				_, _ = io.WriteString(w, `{}`)
+			}))
+			defer server.Close()
+
+			inst := newTestInstance(t, server.URL, 0)
+			inst.settings.MaxRetries = 3
+			inst.settings.RetryBaseDelay = 1
+			inst.settings.RetryMaxDelay = 1000
+
+			start := time.Now()
+
+			_, err := inst.doWebMonitoringAPIQuery(context.Background(), server.URL, "token")
+			if !errors.Is(err, tt.err) && !(tt.err == nil && err == nil) {
+				t.Errorf("error = %v, want %v", err, tt.err)
+			}
+
+			if n := atomic.LoadInt32(&attempts); n != tt.attempts {
+				t.Errorf("%d attempts, want %d", n, tt.attempts)
+			}
+
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("took %s", elapsed)
+			}
+		})
+	}
+}
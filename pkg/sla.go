@@ -0,0 +1,414 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// defaultSLATarget is the SLA target in percent if none is configured.
+const defaultSLATarget = 99.9
+
+// slaSettings is the SLA definition of the query model.
+type slaSettings struct {
+	// Target is the SLA target in percent
+	Target float64 `json:"target"`
+	// Timezone of the business hours, e.g. Europe/Berlin
+	Timezone string `json:"timezone"`
+	// BusinessHours is the weekly schedule the SLA applies to, empty for 24/7
+	BusinessHours []businessHours `json:"businessHours"`
+	// Exclusions are planned maintenance windows
+	Exclusions []timeWindow `json:"exclusions"`
+}
+
+// businessHours are the business hours on the given days, Start and End are
+// in the format 15:04, End may be 24:00.
+type businessHours struct {
+	Days  []string `json:"days"`
+	Start string   `json:"start"`
+	End   string   `json:"end"`
+}
+
+type timeWindow struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// slaSchedule is the parsed SLA definition.
+type slaSchedule struct {
+	target     float64
+	location   *time.Location
+	hours      []parsedBusinessHours
+	exclusions []timeWindow
+}
+
+type parsedBusinessHours struct {
+	days  [7]bool
+	start time.Duration
+	end   time.Duration
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// parseSLASettings validates the SLA definition of the query model.
+func parseSLASettings(settings *slaSettings) (*slaSchedule, error) {
+	if settings == nil {
+		settings = &slaSettings{}
+	}
+
+	schedule := &slaSchedule{
+		target:     settings.Target,
+		location:   time.UTC,
+		exclusions: settings.Exclusions,
+	}
+
+	if schedule.target == 0 {
+		schedule.target = defaultSLATarget
+	}
+
+	if schedule.target < 0 || schedule.target > 100 {
+		return nil, fmt.Errorf("invalid SLA target: %v", settings.Target)
+	}
+
+	if settings.Timezone != "" {
+		location, err := time.LoadLocation(settings.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone '%s': %w", settings.Timezone, err)
+		}
+
+		schedule.location = location
+	}
+
+	for _, bh := range settings.BusinessHours {
+		parsed, err := parseBusinessHours(bh)
+		if err != nil {
+			return nil, err
+		}
+
+		schedule.hours = append(schedule.hours, parsed)
+	}
+
+	for _, w := range settings.Exclusions {
+		if !w.To.After(w.From) {
+			return nil, fmt.Errorf("invalid exclusion: %v must be before %v", w.From, w.To)
+		}
+	}
+
+	return schedule, nil
+}
+
+func parseBusinessHours(bh businessHours) (parsedBusinessHours, error) {
+	var parsed parsedBusinessHours
+
+	if len(bh.Days) == 0 {
+		return parsed, errors.New("business hours without days")
+	}
+
+	for _, day := range bh.Days {
+		name := strings.ToLower(day)
+		if len(name) > 3 {
+			name = name[:3]
+		}
+
+		weekday, ok := weekdays[name]
+		if !ok {
+			return parsed, fmt.Errorf("invalid day: '%s'", day)
+		}
+
+		parsed.days[weekday] = true
+	}
+
+	var err error
+
+	if parsed.start, err = parseTimeOfDay(bh.Start); err != nil {
+		return parsed, err
+	}
+
+	if parsed.end, err = parseTimeOfDay(bh.End); err != nil {
+		return parsed, err
+	}
+
+	if parsed.end <= parsed.start {
+		return parsed, fmt.Errorf("invalid business hours: %s must be before %s", bh.Start, bh.End)
+	}
+
+	return parsed, nil
+}
+
+// parseTimeOfDay parses a time of day in the format 15:04, allowing 24:00.
+func parseTimeOfDay(value string) (time.Duration, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid time of day: '%s'", value)
+	}
+
+	hours, errHours := strconv.Atoi(parts[0])
+	minutes, errMinutes := strconv.Atoi(parts[1])
+
+	if errHours != nil || errMinutes != nil || hours < 0 || minutes < 0 || minutes > 59 ||
+		hours > 24 || (hours == 24 && minutes != 0) {
+		return 0, fmt.Errorf("invalid time of day: '%s'", value)
+	}
+
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute, nil
+}
+
+// inScope returns whether t is within the business hours and not excluded.
+func (s *slaSchedule) inScope(t time.Time) bool {
+	for _, w := range s.exclusions {
+		if !t.Before(w.From) && t.Before(w.To) {
+			return false
+		}
+	}
+
+	if len(s.hours) == 0 {
+		return true
+	}
+
+	lt := t.In(s.location)
+
+	for _, bh := range s.hours {
+		if !bh.days[lt.Weekday()] {
+			continue
+		}
+
+		if !t.Before(s.timeOfDay(lt, bh.start)) && t.Before(s.timeOfDay(lt, bh.end)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// timeOfDay returns the wall clock time of day on the date of day in the SLA
+// timezone. Adding the time of day to midnight instead would shift it by an
+// hour on days with a daylight saving time change.
+func (s *slaSchedule) timeOfDay(day time.Time, timeOfDay time.Duration) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), int(timeOfDay/time.Hour), int(timeOfDay%time.Hour/time.Minute),
+		0, 0, s.location)
+}
+
+// scopeDuration returns the duration of [from, to) within the business hours
+// and not excluded.
+func (s *slaSchedule) scopeDuration(from, to time.Time) time.Duration {
+	var windows []timeWindow
+
+	if len(s.hours) == 0 {
+		windows = []timeWindow{{From: from, To: to}}
+	} else {
+		lf := from.In(s.location)
+
+		for day := time.Date(lf.Year(), lf.Month(), lf.Day(), 0, 0, 0, 0, s.location); day.Before(to); day = day.AddDate(0, 0, 1) {
+			for _, bh := range s.hours {
+				if bh.days[day.Weekday()] {
+					w := timeWindow{From: s.timeOfDay(day, bh.start), To: s.timeOfDay(day, bh.end)}
+					windows = append(windows, clipWindow(w, from, to))
+				}
+			}
+		}
+	}
+
+	windows = mergeWindows(windows)
+	total := totalDuration(windows)
+
+	var excluded []timeWindow
+
+	for _, w := range s.exclusions {
+		excluded = append(excluded, clipWindow(w, from, to))
+	}
+
+	excluded = mergeWindows(excluded)
+
+	// Only the excluded time within the business hours reduces the scope
+	for _, e := range excluded {
+		for _, w := range windows {
+			total -= totalDuration([]timeWindow{clipWindow(e, w.From, w.To)})
+		}
+	}
+
+	return total
+}
+
+// clipWindow returns the part of w within [from, to), which may be empty.
+func clipWindow(w timeWindow, from, to time.Time) timeWindow {
+	if w.From.Before(from) {
+		w.From = from
+	}
+
+	if w.To.After(to) {
+		w.To = to
+	}
+
+	return w
+}
+
+// mergeWindows merges overlapping windows and drops empty ones.
+func mergeWindows(windows []timeWindow) []timeWindow {
+	sorted := make([]timeWindow, 0, len(windows))
+
+	for _, w := range windows {
+		if w.To.After(w.From) {
+			sorted = append(sorted, w)
+		}
+	}
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].From.Before(sorted[j].From) })
+
+	merged := make([]timeWindow, 0, len(sorted))
+
+	for _, w := range sorted {
+		if n := len(merged); n > 0 && !w.From.After(merged[n-1].To) {
+			if w.To.After(merged[n-1].To) {
+				merged[n-1].To = w.To
+			}
+
+			continue
+		}
+
+		merged = append(merged, w)
+	}
+
+	return merged
+}
+
+func totalDuration(windows []timeWindow) time.Duration {
+	var total time.Duration
+
+	for _, w := range windows {
+		if w.To.After(w.From) {
+			total += w.To.Sub(w.From)
+		}
+	}
+
+	return total
+}
+
+// slaReport is the SLA of a monitor.
+type slaReport struct {
+	achieved float64
+	allowed  time.Duration
+	consumed time.Duration
+	breaches int64
+}
+
+// computeSLA computes the SLA from the results within scope. The achieved SLA
+// is the share of available results, the error budget is the part of the
+// scope duration the target allows to be unavailable. A breach is an outage of
+// the monitor, i.e. a run of unavailable results starting within scope, with
+// the outages of all locations merged.
+func computeSLA(schedule *slaSchedule, results resultColumns, from, to time.Time) slaReport {
+	var total, available int64
+
+	var report slaReport
+
+	var outages []timeWindow
+
+	for _, lr := range results {
+		down := false
+
+		for i, t := range lr.times {
+			class := classifyStatus(lr.statuses[i])
+
+			// An available result ends the outage, even outside of the scope
+			if class == statusUp || class == statusDegraded {
+				if down {
+					outages[len(outages)-1].To = t
+				}
+
+				down = false
+			}
+
+			if !schedule.inScope(t) {
+				continue
+			}
+
+			switch class {
+			case statusUp, statusDegraded:
+				total++
+				available++
+			case statusDown:
+				total++
+
+				// Outages lasting until the end of the range are ended there
+				if !down {
+					outages = append(outages, timeWindow{From: t, To: to})
+				}
+
+				down = true
+			}
+		}
+	}
+
+	report.breaches = int64(len(mergeWindows(outages)))
+
+	scope := schedule.scopeDuration(from, to)
+
+	report.achieved = 100
+	if total > 0 {
+		report.achieved = float64(available) / float64(total) * 100
+	}
+
+	report.allowed = time.Duration(float64(scope) * (100 - schedule.target) / 100)
+	report.consumed = time.Duration(float64(scope) * (100 - report.achieved) / 100)
+
+	return report
+}
+
+// querySLA returns the achieved SLA, the allowed and consumed error budget and
+// the number of breaches in the time range, one row per monitor.
+func (td *WebMonitoringDatasource) querySLA(ctx context.Context, inst *instanceSettings, query *backend.DataQuery,
+	qm *queryModel, apiToken string) backend.DataResponse {
+	response := backend.DataResponse{}
+
+	schedule, err := parseSLASettings(qm.SLA)
+	if err != nil {
+		response.Error = err
+
+		return response
+	}
+
+	sets, _, err := inst.getQueryMonitorResults(ctx, query, qm, apiToken)
+	if err != nil {
+		response.Error = err
+
+		return response
+	}
+
+	frame := data.NewFrame("sla",
+		data.NewField("Monitor", nil, []string{}),
+		data.NewField("SLA", nil, []float64{}).SetConfig(&data.FieldConfig{Unit: "percent"}),
+		data.NewField("Target", nil, []float64{}).SetConfig(&data.FieldConfig{Unit: "percent"}),
+		data.NewField("Error Budget", nil, []float64{}).SetConfig(&data.FieldConfig{Unit: "s"}),
+		data.NewField("Error Budget Consumed", nil, []float64{}).SetConfig(&data.FieldConfig{Unit: "s"}),
+		data.NewField("Error Budget Remaining", nil, []float64{}).SetConfig(&data.FieldConfig{Unit: "percent"}),
+		data.NewField("Breaches", nil, []int64{}),
+	)
+
+	for i := range sets {
+		report := computeSLA(schedule, sets[i].results, query.TimeRange.From, query.TimeRange.To)
+
+		remaining := 100.0
+		if report.allowed > 0 {
+			remaining = (1 - report.consumed.Seconds()/report.allowed.Seconds()) * 100
+		} else if report.consumed > 0 {
+			remaining = 0
+		}
+
+		frame.AppendRow(sets[i].monitor.Name, report.achieved, schedule.target, report.allowed.Seconds(),
+			report.consumed.Seconds(), remaining, report.breaches)
+	}
+
+	response.Frames = append(response.Frames, frame)
+
+	return response
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSLAScheduleDaylightSavingTime(t *testing.T) {
+	schedule, err := parseSLASettings(&slaSettings{
+		Timezone:      "Europe/Berlin",
+		BusinessHours: []businessHours{{Days: []string{"sun", "mon"}, Start: "09:00", End: "17:00"}},
+	})
+	if err != nil {
+		t.Fatalf("parseSLASettings: %v", err)
+	}
+
+	berlin := schedule.location
+
+	// The clocks were set forward on 2021-03-28 and back on 2021-10-31, both Sundays
+	for _, day := range []time.Time{
+		time.Date(2021, 3, 28, 0, 0, 0, 0, berlin),
+		time.Date(2021, 10, 31, 0, 0, 0, 0, berlin),
+	} {
+		for _, tt := range []struct {
+			hour, minute int
+			want         bool
+		}{
+			{8, 59, false},
+			{9, 0, true},
+			{16, 59, true},
+			{17, 0, false},
+		} {
+			ts := time.Date(day.Year(), day.Month(), day.Day(), tt.hour, tt.minute, 0, 0, berlin)
+			if got := schedule.inScope(ts); got != tt.want {
+				t.Errorf("inScope(%s) = %v, want %v", ts, got, tt.want)
+			}
+		}
+
+		if got := schedule.scopeDuration(day, day.AddDate(0, 0, 1)); got != 8*time.Hour {
+			t.Errorf("scopeDuration of %s = %s, want 8h", day.Format("2006-01-02"), got)
+		}
+	}
+}
+
+func TestComputeSLABreaches(t *testing.T) {
+	schedule, err := parseSLASettings(&slaSettings{
+		Target:        99,
+		Timezone:      "UTC",
+		BusinessHours: []businessHours{{Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "09:00", End: "17:00"}},
+	})
+	if err != nil {
+		t.Fatalf("parseSLASettings: %v", err)
+	}
+
+	at := func(day, hour, minute int) time.Time { return time.Date(2021, 7, day, hour, minute, 0, 0, time.UTC) }
+
+	// 2021-07-02 is a Friday, 2021-07-05 a Monday
+	location := func(statuses ...string) *locationResults {
+		times := []time.Time{at(2, 16, 40), at(2, 16, 50), at(2, 18, 50), at(5, 9, 0), at(5, 9, 10)}
+
+		return &locationResults{times: times[:len(statuses)], statuses: statuses}
+	}
+
+	for _, tt := range []struct {
+		name    string
+		results resultColumns
+		want    int64
+	}{
+		// The Friday outage ends after business hours, the Monday outage is a new one
+		{"after hours recovery", resultColumns{1: location("Ok", "Error", "Ok", "Error", "Ok")}, 2},
+		// The same Friday outage seen from two locations
+		{"locations", resultColumns{1: location("Ok", "Error", "Ok"), 2: location("Ok", "Error", "Ok")}, 1},
+	} {
+		report := computeSLA(schedule, tt.results, at(2, 0, 0), at(6, 0, 0))
+		if report.breaches != tt.want {
+			t.Errorf("%s: breaches = %d, want %d", tt.name, report.breaches, tt.want)
+		}
+	}
+}
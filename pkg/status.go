@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"sort"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// statusColors are the colors of the classified statuses in the value mappings.
+var statusColors = map[string]string{
+	statusUp:       "green",
+	statusDown:     "red",
+	statusDegraded: "orange",
+	statusUnknown:  "text",
+}
+
+// statusOrder is the order of the classified statuses in the value mappings.
+var statusOrder = []string{statusUp, statusDegraded, statusDown, statusUnknown}
+
+// statusTexts are the display texts of the classified statuses.
+var statusTexts = map[string]string{
+	statusUp:       "Up",
+	statusDown:     "Down",
+	statusDegraded: "Degraded",
+	statusUnknown:  "Unknown",
+}
+
+// queryStatus returns the status of the monitor results per location as a
+// time series of strings, for state timeline panels. The statuses are either
+// classified as up, down, degraded or unknown, or the raw API statuses.
+func (td *WebMonitoringDatasource) queryStatus(ctx context.Context, inst *instanceSettings, query *backend.DataQuery,
+	qm *queryModel, apiToken string) backend.DataResponse {
+	response := backend.DataResponse{}
+
+	sets, locations, err := inst.getQueryMonitorResults(ctx, query, qm, apiToken)
+	if err != nil {
+		response.Error = err
+
+		return response
+	}
+
+	for i := range sets {
+		monitorResults := sets[i].results
+
+		for _, locationID := range sortedLocationIDs(monitorResults, locations) {
+			lr := monitorResults[locationID]
+
+			statuses := make([]string, len(lr.statuses))
+
+			for j, status := range lr.statuses {
+				if qm.RawStatus {
+					statuses[j] = status
+				} else {
+					statuses[j] = classifyStatus(status)
+				}
+			}
+
+			name := seriesName(qm, &sets[i].monitor, locations.name(locationID))
+
+			frame := seriesFrame(name, lr.times, "status", locations.labels(&sets[i].monitor, locationID), statuses,
+				&data.FieldConfig{
+					Mappings: statusMappings(statuses, qm.RawStatus),
+				})
+
+			response.Frames = append(response.Frames, locations.noticeMissing(frame, locationID))
+		}
+	}
+
+	return response
+}
+
+// statusMappings returns the value mappings coloring the statuses.
+func statusMappings(statuses []string, raw bool) data.ValueMappings {
+	mapper := make(data.ValueMapper)
+
+	if !raw {
+		for i, status := range statusOrder {
+			mapper[status] = data.ValueMappingResult{Text: statusTexts[status], Color: statusColors[status], Index: i}
+		}
+
+		return data.ValueMappings{mapper}
+	}
+
+	distinct := make([]string, 0)
+
+	for _, status := range statuses {
+		if _, ok := mapper[status]; ok {
+			continue
+		}
+
+		mapper[status] = data.ValueMappingResult{Text: status, Color: statusColors[classifyStatus(status)]}
+		distinct = append(distinct, status)
+	}
+
+	// The index only orders the mappings in the UI
+	sort.Strings(distinct)
+
+	for i, status := range distinct {
+		m := mapper[status]
+		m.Index = i
+		mapper[status] = m
+	}
+
+	return data.ValueMappings{mapper}
+}
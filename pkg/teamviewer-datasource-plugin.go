@@ -5,11 +5,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
-	"sort"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
@@ -19,7 +19,8 @@ import (
 	"github.com/grafana/grafana-plugin-sdk-go/data"
 )
 
-// webMonitingAPIBasePath base path, see https://webapi.teamviewer.com/api/v1/docs/index#/
+// webMonitingAPIBasePath default base path, see https://webapi.teamviewer.com/api/v1/docs/index#/
+// It can be overridden with `apiBaseURL` in the datasource jsonData.
 const webMonitingAPIBasePath = "https://webapi.teamviewer.com/api/v1"
 
 // newDatasource returns datasource.ServeOpts.
@@ -48,6 +49,21 @@ type WebMonitoringDatasource struct {
 	im instancemgmt.InstanceManager
 }
 
+// getInstance returns the instance settings of the datasource the request belongs to.
+func (td *WebMonitoringDatasource) getInstance(pluginContext backend.PluginContext) (*instanceSettings, error) {
+	instance, err := td.im.Get(pluginContext)
+	if err != nil {
+		return nil, fmt.Errorf("get datasource instance: %w", err)
+	}
+
+	inst, ok := instance.(*instanceSettings)
+	if !ok {
+		return nil, errors.New("invalid datasource instance")
+	}
+
+	return inst, nil
+}
+
 type monitor struct {
 	MonitorID   string `json:"monitorId"`
 	MonitorType string `json:"type"`
@@ -60,14 +76,45 @@ type monitorsResponse struct {
 	ContinuationToken string    `json:"continuationToken"`
 }
 
-func (td *WebMonitoringDatasource) getLocations(ctx context.Context, apiToken string) ([]location, error) {
-	queryURL := webMonitingAPIBasePath + "/webMonitoring/locations"
+func (r *monitorsResponse) nextToken() string {
+	return r.ContinuationToken
+}
+
+func (r *monitorsResponse) itemCount() int {
+	return len(r.Monitors)
+}
+
+// getLocations returns the monitoring locations, cached for the configured TTL.
+func (s *instanceSettings) getLocations(ctx context.Context, apiToken string) ([]location, error) {
+	if cached, ok := s.cache.Get(cacheKeyLocations); ok {
+		return cached.([]location), nil
+	}
+
+	v, shared, err := s.inflight.Do(ctx, requestKey(s.settings.Endpoints.Locations, apiToken), s.settings.queryTimeout(),
+		func(ctx context.Context) (interface{}, error) {
+			return s.requestLocations(ctx, apiToken)
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	locations := v.([]location)
+
+	if !shared {
+		s.cache.Set(cacheKeyLocations, locations, s.settings.locationsCacheTTL())
+	}
+
+	return locations, nil
+}
+
+func (s *instanceSettings) requestLocations(ctx context.Context, apiToken string) ([]location, error) {
+	queryURL := s.settings.apiURL(s.settings.Endpoints.Locations)
 
-	body, err := doWebMonitoringAPIQuery(ctx, queryURL, apiToken)
+	body, err := s.doWebMonitoringAPIQuery(ctx, queryURL, apiToken)
 	if err != nil {
 		log.DefaultLogger.Error(err.Error())
 
-		return nil, errors.New("api call failed")
+		return nil, err
 	}
 
 	log.DefaultLogger.Debug(fmt.Sprintf("Locations (raw): %v", string(body)))
@@ -78,119 +125,94 @@ func (td *WebMonitoringDatasource) getLocations(ctx context.Context, apiToken st
 	if err != nil {
 		log.DefaultLogger.Error("json unmarshall: ", err.Error())
 
-		return nil, errors.New("couldn't parse location json")
+		return nil, newDecodeError(err)
 	}
 
 	return locations, nil
 }
 
-func (td *WebMonitoringDatasource) getMonitors(ctx context.Context, apiToken string) ([]monitor, error) {
-	monitors := make([]monitor, 0)
-
-	var continuationToken string
-
-	for {
-		u, err := url.Parse(webMonitingAPIBasePath + "/webMonitoring/monitors")
-		if err != nil {
-			log.DefaultLogger.Error("Couldn't parse API call: ", err.Error())
+// getMonitors returns all monitors, cached for the configured TTL.
+func (s *instanceSettings) getMonitors(ctx context.Context, apiToken string) ([]monitor, error) {
+	if cached, ok := s.cache.Get(cacheKeyMonitors); ok {
+		return cached.([]monitor), nil
+	}
 
-			return nil, errors.New("couldn't parse API call")
-		}
+	v, shared, err := s.inflight.Do(ctx, requestKey(s.settings.Endpoints.Monitors, apiToken), s.settings.queryTimeout(),
+		func(ctx context.Context) (interface{}, error) {
+			return s.requestMonitors(ctx, apiToken)
+		})
+	if err != nil {
+		return nil, err
+	}
 
-		q := u.Query()
+	monitors := v.([]monitor)
 
-		if continuationToken != "" {
-			q.Set("continuationToken", continuationToken)
-		}
+	if !shared {
+		s.cache.Set(cacheKeyMonitors, monitors, s.settings.monitorsCacheTTL())
+	}
 
-		u.RawQuery = q.Encode()
+	return monitors, nil
+}
 
-		// start request
-		body, err := doWebMonitoringAPIQuery(ctx, u.String(), apiToken)
-		if err != nil {
-			log.DefaultLogger.Error(err.Error())
+func (s *instanceSettings) requestMonitors(ctx context.Context, apiToken string) ([]monitor, error) {
+	monitors := make([]monitor, 0)
 
-			return nil, errors.New("get monitors API call failed")
-		}
+	p := s.newPaginator("monitors", s.settings.Endpoints.Monitors, apiToken, nil)
 
+	for p.HasNext() {
 		var resp monitorsResponse
 
-		err = json.Unmarshal(body, &resp)
-		if err != nil {
-			log.DefaultLogger.Error("json unmarshall: ", err.Error())
-
-			return nil, errors.New("parsing json failed")
+		if err := p.Next(ctx, &resp); err != nil {
+			return nil, err
 		}
 
 		monitors = append(monitors, resp.Monitors...)
-
-		if resp.ContinuationToken != "" {
-			continuationToken = resp.ContinuationToken
-		} else {
-			break
-		}
 	}
 
 	return monitors, nil
 }
 
-func (td *WebMonitoringDatasource) getMonitorResults(ctx context.Context, apiToken, monitorID string,
-	timeFrom, timeTo time.Time) ([]monitorResult, error) {
-	result := make([]monitorResult, 0)
-
-	var continuationToken string
-
-	// Request monitor results
-	for {
-		u, err := url.Parse(webMonitingAPIBasePath + "/webMonitoring/monitorResults")
-		if err != nil {
-			log.DefaultLogger.Error("Couldn't parse API call: ", err.Error())
-
-			return result, errors.New("invalid url")
-		}
-
-		q := u.Query()
-		q.Set("monitorid", monitorID)
-		q.Set("start", timeFrom.Format("2006-01-02T15:04:05Z07:00"))
-		q.Set("end", timeTo.Format("2006-01-02T15:04:05Z07:00"))
-
-		if continuationToken != "" {
-			q.Set("continuationToken", continuationToken)
-		}
-
-		u.RawQuery = q.Encode()
-
-		log.DefaultLogger.Debug(fmt.Sprintf("Requesting monitor results, MonitorID: %v, From: %v, To: %v, ContinuationToken: %v",
-			monitorID, timeFrom, timeTo, continuationToken))
+// requestMonitorResultsOnce requests the monitor results, sharing the result
+// with identical requests in flight.
+func (s *instanceSettings) requestMonitorResultsOnce(ctx context.Context, apiToken, monitorID string,
+	timeFrom, timeTo time.Time) (resultColumns, error) {
+	key := requestKey(s.settings.Endpoints.MonitorResults, apiToken,
+		monitorID, timeFrom.Format(time.RFC3339Nano), timeTo.Format(time.RFC3339Nano))
 
-		body, err := doWebMonitoringAPIQuery(ctx, u.String(), apiToken)
-		if err != nil {
-			log.DefaultLogger.Error(err.Error())
-
-			return result, errors.New("api call failed")
-		}
+	v, shared, err := s.inflight.Do(ctx, key, s.settings.queryTimeout(), func(ctx context.Context) (interface{}, error) {
+		return s.requestMonitorResults(ctx, apiToken, monitorID, timeFrom, timeTo)
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		log.DefaultLogger.Debug(fmt.Sprintf("MonitorResults (raw): %v", string(body)))
+	if shared {
+		log.DefaultLogger.Debug(fmt.Sprintf("Shared in-flight monitor results request, MonitorID: %v, From: %v, To: %v",
+			monitorID, timeFrom, timeTo))
+	}
 
-		var monitorResults monitorResultsResponse
+	return v.(resultColumns), nil
+}
 
-		err = json.Unmarshal(body, &monitorResults)
-		if err != nil {
-			log.DefaultLogger.Error("json unmarshall: ", err.Error())
+func (s *instanceSettings) requestMonitorResults(ctx context.Context, apiToken, monitorID string,
+	timeFrom, timeTo time.Time) (resultColumns, error) {
+	result := make(resultColumns)
 
-			return result, errors.New("parsing response failed")
-		}
+	log.DefaultLogger.Debug(fmt.Sprintf("Requesting monitor results, MonitorID: %v, From: %v, To: %v",
+		monitorID, timeFrom, timeTo))
 
-		log.DefaultLogger.Debug(fmt.Sprintf("Results in total: %v, ContinuationToken: %v",
-			len(monitorResults.MonitorResults), monitorResults.ContinuationToken))
-		log.DefaultLogger.Debug(fmt.Sprintf("Results: %v", monitorResults.MonitorResults))
+	p := s.newPaginator("monitor results", s.settings.Endpoints.MonitorResults, apiToken, url.Values{
+		"monitorid": {monitorID},
+		"start":     {timeFrom.Format("2006-01-02T15:04:05Z07:00")},
+		"end":       {timeTo.Format("2006-01-02T15:04:05Z07:00")},
+	})
 
-		result = append(result, monitorResults.MonitorResults...)
+	// Request monitor results, the pages are decoded into the same columns
+	page := &monitorResultsPage{columns: result}
 
-		if monitorResults.ContinuationToken != "" {
-			continuationToken = monitorResults.ContinuationToken
-		} else {
-			break
+	for p.HasNext() {
+		if err := p.Next(ctx, page); err != nil {
+			return nil, err
 		}
 	}
 
@@ -212,59 +234,32 @@ type alarmResponse struct {
 	ContinuationToken string  `json:"continuationToken"`
 }
 
-func (td *WebMonitoringDatasource) getAlarms(ctx context.Context, apiToken string, timeFrom, timeTo time.Time) ([]alarm, error) {
-	alarms := make([]alarm, 0)
-
-	var continuationToken string
-
-	for {
-		u, err := url.Parse(webMonitingAPIBasePath + "/webMonitoring/alarms")
-		if err != nil {
-			log.DefaultLogger.Error("Couldn't parse API call: ", err.Error())
-
-			return nil, errors.New("couldn't parse API call")
-		}
-
-		q := u.Query()
-		q.Set("start", timeFrom.Format("2006-01-02T15:04:05Z07:00"))
-		q.Set("end", timeTo.Format("2006-01-02T15:04:05Z07:00"))
+func (r *alarmResponse) nextToken() string {
+	return r.ContinuationToken
+}
 
-		if continuationToken != "" {
-			q.Set("continuationToken", continuationToken)
-		}
+func (r *alarmResponse) itemCount() int {
+	return len(r.Alarms)
+}
 
-		log.DefaultLogger.Debug(fmt.Sprintf("Requesting alarms, Start: %v, End: %v, ContiuationToken: %v",
-			timeFrom, timeTo, continuationToken))
+func (s *instanceSettings) getAlarms(ctx context.Context, apiToken string, timeFrom, timeTo time.Time) ([]alarm, error) {
+	alarms := make([]alarm, 0)
 
-		u.RawQuery = q.Encode()
+	log.DefaultLogger.Debug(fmt.Sprintf("Requesting alarms, Start: %v, End: %v", timeFrom, timeTo))
 
-		// start request
-		body, err := doWebMonitoringAPIQuery(ctx, u.String(), apiToken)
-		if err != nil {
-			log.DefaultLogger.Error(err.Error())
-
-			return nil, errors.New("get monitors API call failed")
-		}
+	p := s.newPaginator("alarms", s.settings.Endpoints.Alarms, apiToken, url.Values{
+		"start": {timeFrom.Format("2006-01-02T15:04:05Z07:00")},
+		"end":   {timeTo.Format("2006-01-02T15:04:05Z07:00")},
+	})
 
+	for p.HasNext() {
 		var resp alarmResponse
 
-		err = json.Unmarshal(body, &resp)
-		if err != nil {
-			log.DefaultLogger.Error("json unmarshall: ", err.Error())
-
-			return nil, errors.New("parsing json failed")
+		if err := p.Next(ctx, &resp); err != nil {
+			return nil, err
 		}
 
-		log.DefaultLogger.Debug(fmt.Sprintf("Received %v alarms",
-			len(resp.Alarms)))
-
 		alarms = append(alarms, resp.Alarms...)
-
-		if resp.ContinuationToken != "" {
-			continuationToken = resp.ContinuationToken
-		} else {
-			break
-		}
 	}
 
 	return alarms, nil
@@ -283,16 +278,26 @@ func (td *WebMonitoringDatasource) CallResource(ctx context.Context, req *backen
 		return errors.New("invalid api token")
 	}
 
+	inst, err := td.getInstance(req.PluginContext)
+	if err != nil {
+		log.DefaultLogger.Error(err.Error())
+
+		return errors.New("invalid datasource settings")
+	}
+
 	response := &backend.CallResourceResponse{}
 
 	log.DefaultLogger.Debug(fmt.Sprintf("Path: %s", req.Path))
 
 	if req.Path == "rm/webmonitoring/monitors" {
-		monitors, err := td.getMonitors(ctx, apiToken)
+		monitors, err := inst.getMonitors(ctx, apiToken)
 		if err != nil {
 			log.DefaultLogger.Error("get monitors failed: ", err.Error())
 
-			return errors.New("get monitors failed")
+			response.Status = httpStatus(err)
+			response.Body = errorResponseBody("get monitors failed", err)
+
+			return sendResourceResponse(sender, response)
 		}
 
 		b, err := json.Marshal(monitors)
@@ -302,12 +307,50 @@ func (td *WebMonitoringDatasource) CallResource(ctx context.Context, req *backen
 			return errors.New("serializing json failed")
 		}
 
+		response.Body = b
+		response.Status = 200
+	} else if req.Path == "rm/cache/flush" {
+		// Flushing changes state, so it isn't triggered by a plain GET
+		if req.Method != http.MethodPost {
+			response.Status = http.StatusMethodNotAllowed
+			response.Headers = map[string][]string{"Allow": {http.MethodPost}}
+			response.Body = errorResponseBody("flush cache failed",
+				fmt.Errorf("method %s not allowed, use %s", req.Method, http.MethodPost))
+
+			return sendResourceResponse(sender, response)
+		}
+
+		flushed := inst.cache.Flush() + inst.resultsCache.Flush()
+
+		log.DefaultLogger.Info(fmt.Sprintf("Flushed %d cache entries", flushed))
+
+		b, err := json.Marshal(map[string]int{"flushed": flushed})
+		if err != nil {
+			log.DefaultLogger.Error("json marshall: ", err.Error())
+
+			return errors.New("serializing json failed")
+		}
+
+		response.Body = b
+		response.Status = 200
+	} else if req.Path == "rm/cache/stats" {
+		b, err := json.Marshal(inst.resultsCache.Stats())
+		if err != nil {
+			log.DefaultLogger.Error("json marshall: ", err.Error())
+
+			return errors.New("serializing json failed")
+		}
+
 		response.Body = b
 		response.Status = 200
 	} else {
 		response.Status = 404
 	}
 
+	return sendResourceResponse(sender, response)
+}
+
+func sendResourceResponse(sender backend.CallResourceResponseSender, response *backend.CallResourceResponse) error {
 	if err := sender.Send(response); err != nil {
 		log.DefaultLogger.Error("send response failed: ", err.Error())
 
@@ -337,15 +380,51 @@ func (td *WebMonitoringDatasource) QueryData(ctx context.Context, req *backend.Q
 		return response, nil
 	}
 
-	// loop over queries and execute them individually.
+	inst, err := td.getInstance(req.PluginContext)
+	if err != nil {
+		log.DefaultLogger.Error(err.Error())
+
+		return nil, errors.New("invalid datasource settings")
+	}
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+
+	// execute the queries concurrently, limited by the number of workers
+	workers := make(chan struct{}, inst.settings.maxConcurrentQueries())
+
 	for i := range req.Queries {
-		res := td.query(ctx, &req.Queries[i], apiToken)
+		wg.Add(1)
+
+		go func(query *backend.DataQuery) {
+			defer wg.Done()
+
+			workers <- struct{}{}
+			defer func() { <-workers }()
+
+			queryCtx, cancel := context.WithTimeout(withRateLimitWait(ctx), inst.settings.queryTimeout())
+			defer cancel()
 
-		// save the response in a hashmap
-		// based on with RefID as identifier
-		response.Responses[req.Queries[i].RefID] = res
+			res := td.query(queryCtx, inst, query, apiToken)
+
+			if waited := rateLimitWaited(queryCtx); waited > 0 {
+				for _, frame := range res.Frames {
+					frame.AppendNotices(rateLimitNotice(waited))
+				}
+			}
+
+			// save the response in a hashmap
+			// based on with RefID as identifier
+			mu.Lock()
+			response.Responses[query.RefID] = res
+			mu.Unlock()
+		}(&req.Queries[i])
 	}
 
+	wg.Wait()
+
 	log.DefaultLogger.Debug(fmt.Sprintf("QueryData finished, time: %s", time.Since(now)))
 
 	return response, nil
@@ -356,14 +435,25 @@ type tokenValid struct {
 }
 
 type queryModel struct {
-	Product   string `json:"queryProduct"`
-	Type      string `json:"queryType"`
-	MonitorID string `json:"queryMonitorID"`
-}
-
-type monitorResultsResponse struct {
-	MonitorResults    []monitorResult `json:"monitorResults"`
-	ContinuationToken string          `json:"continuationToken"`
+	Product             string       `json:"queryProduct"`
+	Type                string       `json:"queryType"`
+	MonitorID           string       `json:"queryMonitorID"`
+	MonitorIDs          []string     `json:"queryMonitorIDs"`
+	MonitorNameRegex    string       `json:"queryMonitorNameRegex"`
+	MonitorType         string       `json:"queryMonitorType"`
+	Locations           []string     `json:"queryLocations"`
+	GroupBy             string       `json:"queryGroupBy"`
+	AlarmTypes          []string     `json:"queryAlarmTypes"`
+	AlarmStates         []string     `json:"queryAlarmStates"`
+	MinAlarmDuration    float64      `json:"queryMinAlarmDuration"`
+	AlarmSort           string       `json:"queryAlarmSort"`
+	AlarmSortDesc       bool         `json:"queryAlarmSortDesc"`
+	AlarmLimit          int          `json:"queryAlarmLimit"`
+	KeepDeletedMonitors bool         `json:"queryKeepDeletedMonitors"`
+	Aggregation         string       `json:"queryAggregation"`
+	PerInterval         bool         `json:"queryPerInterval"`
+	RawStatus           bool         `json:"queryRawStatus"`
+	SLA                 *slaSettings `json:"querySLA"`
 }
 
 type monitorResult struct {
@@ -380,7 +470,8 @@ type location struct {
 	City        string `json:"city"`
 }
 
-func (td *WebMonitoringDatasource) query(ctx context.Context, query *backend.DataQuery, apiToken string) backend.DataResponse {
+func (td *WebMonitoringDatasource) query(ctx context.Context, inst *instanceSettings, query *backend.DataQuery,
+	apiToken string) backend.DataResponse {
 	// Unmarshal the json into our queryModel
 	var qm queryModel
 
@@ -404,191 +495,27 @@ func (td *WebMonitoringDatasource) query(ctx context.Context, query *backend.Dat
 
 	switch {
 	case qm.Type == "monitorresults":
-		// Log a warning if `MonitorID` is empty.
-		if qm.MonitorID == "" {
-			log.DefaultLogger.Error("MonitorID is empty")
-
-			response.Error = errors.New("invalid monitor id")
-
-			return response
-		}
-
-		log.DefaultLogger.Info(fmt.Sprintf("MonitorID: %v", qm.MonitorID))
-
-		// Request locations
-		locations, err := td.getLocations(ctx, apiToken)
-		if err != nil {
-			log.DefaultLogger.Error("getLocations: ", err.Error())
-
-			response.Error = errors.New("get locations failed")
-
-			return response
-		}
-
-		// Get monitor results
-		monitorResults, err := td.getMonitorResults(ctx, apiToken, qm.MonitorID, query.TimeRange.From, query.TimeRange.To)
-		if err != nil {
-			log.DefaultLogger.Error("getMonitorResults: ", err.Error())
-
-			response.Error = errors.New("get monitor results failed")
-
-			return response
-		}
-
-		type LocationResults struct {
-			times  []time.Time
-			values []int32
-		}
-
-		resultMap := make(map[int]LocationResults)
-
-		for _, mr := range monitorResults {
-			tmp := resultMap[mr.LocationID]
-
-			tmp.times = append(tmp.times, mr.Time)
-			tmp.values = append(tmp.values, int32(mr.ResponseTime))
-
-			resultMap[mr.LocationID] = tmp
-		}
-
-		locationMap := make(map[int]string)
-		locationMapReverse := make(map[string]int)
-
-		for i := 0; i < len(locations); i++ {
-			locationID := locations[i].LocationID
-			locationName := locations[i].City + " (" + strings.ToUpper(locations[i].CountryCode) + ")"
-			locationMap[locationID] = locationName
-			locationMapReverse[locationName] = locationID
-		}
-
-		locationNames := make([]string, 0)
-		for k := range resultMap {
-			locationNames = append(locationNames, locationMap[k])
-		}
-
-		sort.Strings(locationNames)
-
-		for _, locationName := range locationNames {
-			locationID := locationMapReverse[locationName]
-
-			_, ok := resultMap[locationID]
-			if !ok {
-				continue
-			}
-
-			log.DefaultLogger.Debug(fmt.Sprintf("LocationID: %v, LocationName: %v, %v entries",
-				locationID, locationName, len(resultMap[locationID].times)))
-
-			log.DefaultLogger.Debug(fmt.Sprintf("Times: %v entries, %v",
-				len(resultMap[locationID].times), resultMap[locationID].times))
-			log.DefaultLogger.Debug(fmt.Sprintf("Values: %v entries, %v",
-				len(resultMap[locationID].values), resultMap[locationID].values))
-
-			// create data frame response
-			frame := data.NewFrame("response")
-
-			frame.Fields = append(frame.Fields,
-				data.NewField("time", nil, resultMap[locationID].times),        // time dimension
-				data.NewField(locationName, nil, resultMap[locationID].values), // values
-			)
-
-			config := &data.FieldConfig{}
-			config.Unit = "ms"
-
-			frame.Fields[1].SetConfig(config)
-
-			// add the frames to the response
-			response.Frames = append(response.Frames, frame)
-		}
+		return td.queryMonitorResults(ctx, inst, query, &qm, apiToken)
+	case qm.Type == "availability":
+		return td.queryAvailability(ctx, inst, query, &qm, apiToken)
+	case qm.Type == "status":
+		return td.queryStatus(ctx, inst, query, &qm, apiToken)
+	case qm.Type == "sla":
+		return td.querySLA(ctx, inst, query, &qm, apiToken)
 	case qm.Type == "alarms":
-		monitors, err := td.getMonitors(ctx, apiToken)
-		if err != nil {
-			log.DefaultLogger.Error("get monitors failed: ", err.Error())
-
-			response.Error = errors.New("get monitors failed")
-
-			return response
-		}
-
-		monitorsMap := make(map[string]string)
-
-		for _, m := range monitors {
-			monitorsMap[m.MonitorID] = m.Name
-		}
-
-		// Request alarms
-		alarms, err := td.getAlarms(ctx, apiToken, query.TimeRange.From.UTC(), query.TimeRange.To.UTC())
-		if err != nil {
-			log.DefaultLogger.Error("getAlarms: ", err.Error())
-
-			response.Error = errors.New("get alarms failed")
-
-			return response
-		}
-
-		log.DefaultLogger.Debug(fmt.Sprintf("Received %v alarms in total",
-			len(alarms)))
-
-		var monitorNames, alarmStatus, alarmTypes, foundAt, resolvedAt, acknowledgedAt, duration []string
-
-		location, err := time.LoadLocation("UTC")
-		if err != nil {
-			log.DefaultLogger.Error("get location UTC: ", err.Error())
-		}
-
-		for idx := range alarms {
-			m, ok := monitorsMap[alarms[idx].MonitorID]
-			if !ok {
-				continue
-			}
-
-			monitorNames = append(monitorNames, m)
-			alarmStatus = append(alarmStatus, alarms[idx].Status)
-			alarmTypes = append(alarmTypes, alarms[idx].AlarmType)
-			foundAt = append(foundAt, alarms[idx].FoundAt.In(location).Format(time.RFC3339Nano))
-
-			if alarms[idx].ResolvedAt.IsZero() {
-				resolvedAt = append(resolvedAt, "")
-			} else {
-				resolvedAt = append(resolvedAt, alarms[idx].ResolvedAt.In(location).Format(time.RFC3339Nano))
-			}
-
-			if alarms[idx].AcknowledgedAt.IsZero() {
-				acknowledgedAt = append(acknowledgedAt, "")
-			} else {
-				acknowledgedAt = append(acknowledgedAt, alarms[idx].AcknowledgedAt.In(location).Format(time.RFC3339Nano))
-			}
-
-			duration = append(duration, alarms[idx].Duration)
-		}
-
-		log.DefaultLogger.Debug(fmt.Sprintf("MonitorIDs: %v entries, %v",
-			len(monitorNames), monitorNames))
-		log.DefaultLogger.Debug(fmt.Sprintf("AlarmStatus: %v entries, %v",
-			len(alarmStatus), alarmStatus))
-		log.DefaultLogger.Debug(fmt.Sprintf("AlarmType: %v entries, %v",
-			len(alarmTypes), alarmTypes))
-
-		// create data frame response
-		frame := data.NewFrame("response")
-
-		frame.Fields = append(frame.Fields,
-			data.NewField("Monitor ID", nil, monitorNames),
-			data.NewField("Alarm Type", nil, alarmTypes),
-			data.NewField("Status", nil, alarmStatus),
-			data.NewField("Found", nil, foundAt),
-			data.NewField("Resolved", nil, resolvedAt),
-			data.NewField("Acknowledged", nil, acknowledgedAt),
-			data.NewField("Duration", nil, duration))
-
-		// add the frames to the response
-		response.Frames = append(response.Frames, frame)
+		return td.queryAlarms(ctx, inst, query, &qm, apiToken)
+	case qm.Type == "annotations":
+		return td.queryAlarmAnnotations(ctx, inst, query, &qm, apiToken)
+	case qm.Type == "alarmstatistics":
+		return td.queryAlarmStatistics(ctx, inst, query, &qm, apiToken)
+	case qm.Type == "alarmcounts":
+		return td.queryAlarmCounts(ctx, inst, query, &qm, apiToken)
 	case qm.Type == "monitors":
-		monitors, err := td.getMonitors(ctx, apiToken)
+		monitors, err := inst.getMonitors(ctx, apiToken)
 		if err != nil {
 			log.DefaultLogger.Error("get monitors failed: ", err.Error())
 
-			response.Error = errors.New("get monitors failed")
+			response.Error = fmt.Errorf("get monitors failed: %w", err)
 
 			return response
 		}
@@ -623,7 +550,17 @@ func (td *WebMonitoringDatasource) query(ctx context.Context, query *backend.Dat
 // datasource configuration page which allows users to verify that
 // a datasource is working as expected.
 func (td *WebMonitoringDatasource) CheckHealth(ctx context.Context, req *backend.CheckHealthRequest) (*backend.CheckHealthResult, error) {
-	status, message := checkAPIToken(ctx, req.PluginContext.DataSourceInstanceSettings.DecryptedSecureJSONData["apiToken"])
+	inst, err := td.getInstance(req.PluginContext)
+	if err != nil {
+		log.DefaultLogger.Error(err.Error())
+
+		return &backend.CheckHealthResult{
+			Status:  backend.HealthStatusError,
+			Message: err.Error(),
+		}, nil
+	}
+
+	status, message := inst.checkAPIToken(ctx, req.PluginContext.DataSourceInstanceSettings.DecryptedSecureJSONData["apiToken"])
 
 	return &backend.CheckHealthResult{
 		Status:  status,
@@ -632,31 +569,60 @@ func (td *WebMonitoringDatasource) CheckHealth(ctx context.Context, req *backend
 }
 
 type instanceSettings struct {
-	httpClient *http.Client
+	httpClient   *http.Client
+	rateLimiter  *rateLimiter
+	cache        *ttlCache
+	resultsCache *resultsCache
+	inflight     *requestGroup
+	settings     datasourceSettings
 }
 
 func newDataSourceInstance(setting backend.DataSourceInstanceSettings) (instancemgmt.Instance, error) {
+	settings, err := loadDatasourceSettings(setting)
+	if err != nil {
+		log.DefaultLogger.Error("load datasource settings: ", err.Error())
+
+		return nil, err
+	}
+
+	log.DefaultLogger.Debug(fmt.Sprintf("API base URL: %s", settings.APIBaseURL))
+
+	httpClient, err := newHTTPClient(&settings)
+	if err != nil {
+		log.DefaultLogger.Error("create HTTP client: ", err.Error())
+
+		return nil, err
+	}
+
 	return &instanceSettings{
-		httpClient: &http.Client{},
+		httpClient:   httpClient,
+		rateLimiter:  newRateLimiter(settings.rateLimit(), settings.rateLimitBurst()),
+		cache:        newTTLCache(),
+		resultsCache: newResultsCache(settings.resultsCacheBucket(), settings.resultsCacheMaxResults()),
+		inflight:     newRequestGroup(),
+		settings:     settings,
 	}, nil
 }
 
 func (s *instanceSettings) Dispose() {
 	// Called before creatinga a new instance to allow plugin authors
 	// to cleanup.
+	s.httpClient.CloseIdleConnections()
+	s.cache.Flush()
+	s.resultsCache.Flush()
 }
 
 // checkAPIToken do a API call to /ping for checking if the token is valid.
-func checkAPIToken(ctx context.Context, token string) (status backend.HealthStatus, message string) {
+func (s *instanceSettings) checkAPIToken(ctx context.Context, token string) (status backend.HealthStatus, message string) {
 	const couldntCheck = "Couldn't check Token validity"
 
 	var tokenStatus tokenValid
 
 	log.DefaultLogger.Info("Configuring datasource plugin")
 
-	queryURL := webMonitingAPIBasePath + "/ping"
+	queryURL := s.settings.apiURL(s.settings.Endpoints.Ping)
 
-	body, err := doWebMonitoringAPIQuery(ctx, queryURL, token)
+	body, err := s.doWebMonitoringAPIQuery(ctx, queryURL, token)
 	if err != nil {
 		log.DefaultLogger.Error(err.Error())
 
@@ -679,45 +645,150 @@ func checkAPIToken(ctx context.Context, token string) (status backend.HealthStat
 	return backend.HealthStatusUnknown, couldntCheck
 }
 
-func doWebMonitoringAPIQuery(ctx context.Context, queryURL, apiToken string) (body []byte, err error) {
-	client := &http.Client{}
+// maxDrainSize limits how much of an unread response body is discarded to
+// reuse the connection, larger bodies close the connection instead.
+const maxDrainSize = 64 << 10
+
+// closeResponseBody drains and closes the response body, so that the
+// connection can be reused.
+func closeResponseBody(res *http.Response) {
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(res.Body, maxDrainSize))
+
+	if err := res.Body.Close(); err != nil {
+		log.DefaultLogger.Debug(fmt.Sprintf("HTTP close body: %s", err.Error()))
+	}
+}
+
+// doWebMonitoringAPIQuery does an API request and returns the response body.
+func (s *instanceSettings) doWebMonitoringAPIQuery(ctx context.Context, queryURL, apiToken string) (body []byte, err error) {
+	err = s.doWebMonitoringAPIStream(ctx, queryURL, apiToken, func(r io.Reader) error {
+		body, err = ioutil.ReadAll(r)
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.DefaultLogger.Debug(string(body))
 
+	return body, nil
+}
+
+// responseReader limits the size of a response body and records read errors,
+// to tell them apart from decoding errors.
+type responseReader struct {
+	r        io.Reader
+	limit    int64
+	read     int64
+	tooLarge bool
+	err      error
+}
+
+func (r *responseReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.read += int64(n)
+
+	if r.read > r.limit {
+		r.tooLarge = true
+
+		return n, errResponseTooLarge
+	}
+
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+
+	return n, err
+}
+
+// doWebMonitoringAPIRequest does a single API request and passes the response
+// body to decode, see doWebMonitoringAPIStream for retries.
+func (s *instanceSettings) doWebMonitoringAPIRequest(ctx context.Context, queryURL, apiToken string,
+	decode func(io.Reader) error) error {
 	log.DefaultLogger.Debug(fmt.Sprintf("Starting request %s", queryURL))
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, queryURL, nil)
 	if err != nil {
 		log.DefaultLogger.Warn("HTTP New request: ", err.Error())
 
-		return body, fmt.Errorf("HTTP New request: %w", err)
+		return fmt.Errorf("HTTP New request: %w", err)
 	}
 
 	req.Header.Add("Authorization", "Bearer "+apiToken)
 
+	waited, err := s.rateLimiter.Wait(ctx)
+	if err != nil {
+		log.DefaultLogger.Warn(fmt.Sprintf("Rate limiter: %s", err.Error()))
+
+		if ctx.Err() != nil {
+			return &apiError{Kind: errTimeout, Err: err}
+		}
+
+		return &apiError{Kind: errRateLimited, Err: err}
+	}
+
+	if waited > 0 {
+		log.DefaultLogger.Debug(fmt.Sprintf("Waited %s for the rate limiter", waited))
+		addRateLimitWait(ctx, waited)
+	}
+
 	now := time.Now()
 
-	res, err := client.Do(req)
-	if res.StatusCode != http.StatusOK {
+	res, err := s.httpClient.Do(req)
+	if err != nil {
+		log.DefaultLogger.Warn(fmt.Sprintf("HTTP request do: %s", err.Error()))
+
+		if ctx.Err() != nil {
+			return &apiError{Kind: errTimeout, Err: ctx.Err()}
+		}
+
+		return &apiError{Kind: errUpstreamUnavailable, Err: err}
+	}
+	defer closeResponseBody(res)
+
+	if res.StatusCode < http.StatusOK || res.StatusCode >= http.StatusMultipleChoices {
 		log.DefaultLogger.Warn(fmt.Sprintf("HTTP request returned %s", res.Status))
 
-		return body, fmt.Errorf("HTTP request returned %s", res.Status)
-	} else if err != nil {
-		log.DefaultLogger.Warn(fmt.Sprintf("HTTP request do: %s", err.Error()))
+		// A failed read only shortens the error message
+		errBody, _ := ioutil.ReadAll(io.LimitReader(res.Body, maxErrorMessageLength))
 
-		return body, fmt.Errorf("HTTP request do: %w", err)
+		return newStatusError(res, errBody)
 	}
-	defer res.Body.Close()
 
-	body, err = ioutil.ReadAll(res.Body)
-	if err != nil {
-		log.DefaultLogger.Warn(fmt.Sprintf("HTTP readall: %s", err.Error()))
+	maxSize := s.settings.maxResponseSize()
+	body := &responseReader{r: res.Body, limit: maxSize}
+
+	err = decode(body)
+
+	switch {
+	case body.tooLarge:
+		log.DefaultLogger.Warn(fmt.Sprintf("HTTP response of %s exceeds %d bytes", queryURL, maxSize))
 
-		return body, fmt.Errorf("HTTP readall: %w", err)
+		return &apiError{
+			Kind:       errResponseTooLarge,
+			StatusCode: res.StatusCode,
+			Status:     res.Status,
+			Message:    fmt.Sprintf("response exceeds %d bytes", maxSize),
+		}
+	case body.err != nil:
+		log.DefaultLogger.Warn(fmt.Sprintf("HTTP read body: %s", body.err.Error()))
+
+		if ctx.Err() != nil {
+			return &apiError{Kind: errTimeout, Err: ctx.Err()}
+		}
+
+		// No status code, reading the body may succeed when retried
+		return &apiError{Kind: errUpstreamUnavailable, Status: res.Status, Err: body.err}
+	case err != nil:
+		log.DefaultLogger.Error("decode response: ", err.Error())
+
+		return newDecodeError(err)
 	}
 
 	elapsed := time.Since(now)
 
 	log.DefaultLogger.Debug(fmt.Sprintf("Request finished, time: %s", elapsed))
-	log.DefaultLogger.Debug(string(body))
 
-	return body, nil
+	return nil
 }
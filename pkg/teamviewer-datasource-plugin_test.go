@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/iotest"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/datasource"
+)
+
+// newTestInstance returns an instance requesting the test server, without
+// retries and rate limit.
+func newTestInstance(t *testing.T, serverURL string, maxResponseSize int64) *instanceSettings {
+	t.Helper()
+
+	settings := datasourceSettings{
+		APIBaseURL:      serverURL,
+		MaxResponseSize: maxResponseSize,
+		MaxRetries:      -1,
+		RateLimit:       -1,
+	}
+
+	httpClient, err := newHTTPClient(&settings)
+	if err != nil {
+		t.Fatalf("newHTTPClient: %v", err)
+	}
+
+	return &instanceSettings{httpClient: httpClient, settings: settings}
+}
+
+// newTestDatasourceInstance returns an instance with caches and request
+// coalescing as created by Grafana, requesting the test server without
+// retries and rate limit. jsonData holds further settings.
+func newTestDatasourceInstance(t *testing.T, serverURL string, jsonData map[string]interface{}) *instanceSettings {
+	t.Helper()
+
+	settings := map[string]interface{}{"apiBaseURL": serverURL, "maxRetries": -1, "rateLimit": -1}
+	for k, v := range jsonData {
+		settings[k] = v
+	}
+
+	b, err := json.Marshal(settings)
+	if err != nil {
+		t.Fatalf("marshal jsonData: %v", err)
+	}
+
+	inst, err := newDataSourceInstance(backend.DataSourceInstanceSettings{JSONData: b})
+	if err != nil {
+		t.Fatalf("newDataSourceInstance: %v", err)
+	}
+
+	return inst.(*instanceSettings)
+}
+
+func readAll(body *[]byte) func(io.Reader) error {
+	return func(r io.Reader) error {
+		var err error
+
+		*body, err = ioutil.ReadAll(r)
+
+		return err
+	}
+}
+
+func TestDoWebMonitoringAPIRequestSuccess(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer token" {
+			t.Errorf("Authorization = %q", got)
+		}
+
+		_, _ = io.WriteString(w, `{"token_valid":true}`)
+	}))
+	defer server.Close()
+
+	inst := newTestInstance(t, server.URL, 0)
+
+	var body []byte
+
+	if err := inst.doWebMonitoringAPIRequest(context.Background(), server.URL, "token", readAll(&body)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if string(body) != `{"token_valid":true}` {
+		t.Errorf("body = %q", body)
+	}
+}
+
+func TestDoWebMonitoringAPIRequestTransportError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serverURL := server.URL
+	server.Close()
+
+	inst := newTestInstance(t, serverURL, 0)
+
+	err := inst.doWebMonitoringAPIRequest(context.Background(), serverURL, "token", readAll(new([]byte)))
+	if !errors.Is(err, errUpstreamUnavailable) {
+		t.Fatalf("error = %v, want %v", err, errUpstreamUnavailable)
+	}
+
+	var ae *apiError
+	if !errors.As(err, &ae) || ae.StatusCode != 0 {
+		t.Errorf("error = %#v, want no status code", err)
+	}
+}
+
+func TestDoWebMonitoringAPIRequestStatusErrors(t *testing.T) {
+	tests := []struct {
+		status  int
+		body    string
+		kind    error
+		message string
+	}{
+		{http.StatusUnauthorized, `{"error":"invalid_token","error_description":"Token expired"}`, errAuth, "Token expired"},
+		{http.StatusNotFound, `not here`, errNotFound, "not here"},
+		{http.StatusTooManyRequests, ``, errRateLimited, ""},
+		{http.StatusBadRequest, `{"error":"invalid_request"}`, errRequestRejected, "invalid_request"},
+		{http.StatusBadGateway, `bad gateway`, errUpstreamUnavailable, "bad gateway"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			var conns int32
+
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = io.WriteString(w, tt.body)
+			}))
+			server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+				if state == http.StateNew {
+					atomic.AddInt32(&conns, 1)
+				}
+			}
+			server.Start()
+			defer server.Close()
+
+			inst := newTestInstance(t, server.URL, 0)
+
+			const requests = 5
+
+			for i := 0; i < requests; i++ {
+				decoded := false
+
+				err := inst.doWebMonitoringAPIRequest(context.Background(), server.URL, "token", func(io.Reader) error {
+					decoded = true
+
+					return nil
+				})
+				if !errors.Is(err, tt.kind) {
+					t.Fatalf("error = %v, want %v", err, tt.kind)
+				}
+
+				var ae *apiError
+				if !errors.As(err, &ae) || ae.StatusCode != tt.status || ae.Message != tt.message {
+					t.Errorf("error = %#v, want status %d and message %q", err, tt.status, tt.message)
+				}
+
+				if decoded {
+					t.Error("decode called for an error response")
+				}
+			}
+
+			// The body was drained and closed, so connections were reused. The
+			// transport returns a connection to the pool asynchronously, so an
+			// immediate next request may still dial a new one.
+			if n := atomic.LoadInt32(&conns); n >= requests {
+				t.Errorf("%d connections for %d requests, want reused connections", n, requests)
+			}
+		})
+	}
+}
+
+func TestDoWebMonitoringAPIRequestBodyReadFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("hijack: %v", err)
+
+			return
+		}
+		defer conn.Close()
+
+		// The connection is closed before the announced body length
+		_, _ = buf.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 1000\r\n\r\n{\"monitors\":[")
+		_ = buf.Flush()
+	}))
+	defer server.Close()
+
+	inst := newTestInstance(t, server.URL, 0)
+
+	err := inst.doWebMonitoringAPIRequest(context.Background(), server.URL, "token", readAll(new([]byte)))
+	if !errors.Is(err, errUpstreamUnavailable) {
+		t.Fatalf("error = %v, want %v", err, errUpstreamUnavailable)
+	}
+
+	var ae *apiError
+	if !errors.As(err, &ae) || ae.StatusCode != 0 {
+		t.Errorf("error = %#v, want no status code so the request is retried", err)
+	}
+}
+
+func TestDoWebMonitoringAPIRequestDecodeError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `not json`)
+	}))
+	defer server.Close()
+
+	inst := newTestInstance(t, server.URL, 0)
+
+	err := inst.doWebMonitoringAPIRequest(context.Background(), server.URL, "token", func(r io.Reader) error {
+		return errors.New("invalid character")
+	})
+	if !errors.Is(err, errDecode) {
+		t.Fatalf("error = %v, want %v", err, errDecode)
+	}
+}
+
+func TestDoWebMonitoringAPIRequestResponseTooLarge(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, strings.Repeat("x", 1<<20))
+	}))
+	defer server.Close()
+
+	inst := newTestInstance(t, server.URL, 1024)
+
+	var body []byte
+
+	err := inst.doWebMonitoringAPIRequest(context.Background(), server.URL, "token", readAll(&body))
+	if !errors.Is(err, errResponseTooLarge) {
+		t.Fatalf("error = %v, want %v", err, errResponseTooLarge)
+	}
+
+	// Reading stops within a buffer size of the limit
+	if len(body) >= 1<<20 {
+		t.Errorf("read the whole body of %d bytes, the limit is 1024", len(body))
+	}
+}
+
+func TestResponseReader(t *testing.T) {
+	t.Run("limit", func(t *testing.T) {
+		r := &responseReader{r: strings.NewReader("0123456789"), limit: 5}
+
+		_, err := ioutil.ReadAll(r)
+		if !errors.Is(err, errResponseTooLarge) || !r.tooLarge {
+			t.Errorf("error = %v, tooLarge = %v", err, r.tooLarge)
+		}
+	})
+
+	t.Run("within limit", func(t *testing.T) {
+		r := &responseReader{r: strings.NewReader("0123456789"), limit: 10}
+
+		body, err := ioutil.ReadAll(r)
+		if err != nil || string(body) != "0123456789" || r.tooLarge || r.err != nil {
+			t.Errorf("body = %q, error = %v, tooLarge = %v, read error = %v", body, err, r.tooLarge, r.err)
+		}
+	})
+
+	t.Run("read error", func(t *testing.T) {
+		readErr := errors.New("connection reset")
+		r := &responseReader{r: iotest.ErrReader(readErr), limit: 10}
+
+		_, err := ioutil.ReadAll(r)
+		if !errors.Is(err, readErr) || !errors.Is(r.err, readErr) {
+			t.Errorf("error = %v, read error = %v", err, r.err)
+		}
+	})
+}
+
+// trackingBody records how much of it was read and whether it was closed.
+type trackingBody struct {
+	io.Reader
+	read   int
+	closed bool
+}
+
+func (b *trackingBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	b.read += n
+
+	return n, err
+}
+
+func (b *trackingBody) Close() error {
+	b.closed = true
+
+	return nil
+}
+
+func TestCloseResponseBody(t *testing.T) {
+	small := &trackingBody{Reader: strings.NewReader(strings.Repeat("x", 100))}
+	closeResponseBody(&http.Response{Body: small})
+
+	if !small.closed || small.read != 100 {
+		t.Errorf("small body: closed = %v, read = %d, want drained and closed", small.closed, small.read)
+	}
+
+	large := &trackingBody{Reader: strings.NewReader(strings.Repeat("x", 2*maxDrainSize))}
+	closeResponseBody(&http.Response{Body: large})
+
+	if !large.closed || large.read != maxDrainSize {
+		t.Errorf("large body: closed = %v, read = %d, want %d bytes drained and closed", large.closed, large.read,
+			maxDrainSize)
+	}
+}
+
+// responseRecorder keeps the last resource response.
+type responseRecorder struct {
+	response *backend.CallResourceResponse
+}
+
+func (r *responseRecorder) Send(response *backend.CallResourceResponse) error {
+	r.response = response
+
+	return nil
+}
+
+func TestCallResourceCacheFlushMethod(t *testing.T) {
+	td := &WebMonitoringDatasource{im: datasource.NewInstanceManager(newDataSourceInstance)}
+
+	pluginContext := backend.PluginContext{
+		DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{
+			ID:                      1,
+			JSONData:                []byte(`{}`),
+			DecryptedSecureJSONData: map[string]string{"apiToken": "token"},
+		},
+	}
+
+	for method, status := range map[string]int{
+		http.MethodGet:  http.StatusMethodNotAllowed,
+		http.MethodPost: http.StatusOK,
+	} {
+		var sender responseRecorder
+
+		req := &backend.CallResourceRequest{PluginContext: pluginContext, Path: "rm/cache/flush", Method: method}
+		if err := td.CallResource(context.Background(), req, &sender); err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+
+		if sender.response.Status != status {
+			t.Errorf("%s: status = %d, want %d", method, sender.response.Status, status)
+		}
+	}
+}
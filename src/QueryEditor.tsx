@@ -1,5 +1,5 @@
 import React, { PureComponent } from 'react';
-import { InlineField, Select, LegacyForms } from '@grafana/ui';
+import { InlineField, Select, Switch, LegacyForms } from '@grafana/ui';
 import { QueryEditorProps, SelectableValue } from '@grafana/data';
 import { DataSource } from './DataSource';
 import {
@@ -7,7 +7,13 @@ import {
   WMResultsQuery,
   ProductType,
   QueryTypeValue,
+  AggregationValue,
+  GroupByValue,
+  AlarmStateValue,
+  AlarmSortValue,
   WebMonitoringMonitor,
+  BusinessHours,
+  TimeWindow,
 } from './types';
 const { FormField } = LegacyForms;
 
@@ -16,10 +22,92 @@ const defaultQueryType: QueryTypeValue = 'monitorresults';
 
 const queryTypeOptions: Array<SelectableValue<QueryTypeValue>> = [
   { value: 'monitorresults', label: 'Monitor Results' },
+  { value: 'availability', label: 'Availability' },
+  { value: 'status', label: 'Status (State Timeline)' },
+  { value: 'sla', label: 'SLA' },
   { value: 'monitors', label: 'Monitors (Table)' },
   { value: 'alarms', label: 'Alarms (Table)' },
+  { value: 'annotations', label: 'Alarms (Annotations)' },
+  { value: 'alarmstatistics', label: 'Alarm Statistics' },
+  { value: 'alarmcounts', label: 'Alarm Counts (Time Series)' },
 ];
 
+const aggregationOptions: Array<SelectableValue<AggregationValue>> = [
+  { value: 'none', label: 'None (raw results)' },
+  { value: 'avg', label: 'Average' },
+  { value: 'min', label: 'Minimum' },
+  { value: 'max', label: 'Maximum' },
+  { value: 'median', label: 'Median' },
+  { value: 'p95', label: '95th percentile' },
+  { value: 'p99', label: '99th percentile' },
+  { value: 'count', label: 'Count' },
+];
+
+const groupByOptions: Array<SelectableValue<GroupByValue>> = [
+  { value: 'none', label: 'None (per location)' },
+  { value: 'continent', label: 'Continent' },
+  { value: 'country', label: 'Country' },
+];
+
+const alarmQueryTypes: QueryTypeValue[] = ['alarms', 'annotations', 'alarmstatistics', 'alarmcounts'];
+
+const alarmStateOptions: Array<SelectableValue<AlarmStateValue>> = [
+  { value: 'open', label: 'Open' },
+  { value: 'acknowledged', label: 'Acknowledged' },
+  { value: 'resolved', label: 'Resolved' },
+];
+
+const alarmSortOptions: Array<SelectableValue<AlarmSortValue>> = [
+  { value: 'found', label: 'Found' },
+  { value: 'resolved', label: 'Resolved' },
+  { value: 'duration', label: 'Duration' },
+  { value: 'monitor', label: 'Monitor' },
+  { value: 'type', label: 'Alarm Type' },
+];
+
+// formatBusinessHours formats the business hours as e.g. "mon,tue 08:00-18:00; sat 10:00-14:00".
+const formatBusinessHours = (hours?: BusinessHours[]): string =>
+  (hours || []).map((bh) => `${bh.days.join(',')} ${bh.start}-${bh.end}`).join('; ');
+
+// parseBusinessHours parses the format of formatBusinessHours, the backend validates the days and times.
+const parseBusinessHours = (value: string): BusinessHours[] =>
+  value
+    .split(';')
+    .map((entry) => entry.trim())
+    .filter((entry) => entry !== '')
+    .map((entry) => {
+      // The times follow the last space, the days may contain spaces after the commas
+      const days = entry.slice(0, Math.max(entry.lastIndexOf(' '), 0));
+      const [start = '', end = ''] = entry
+        .slice(entry.lastIndexOf(' ') + 1)
+        .split('-')
+        .map((t) => t.trim());
+
+      return {
+        days: days
+          .split(',')
+          .map((day) => day.trim())
+          .filter((day) => day !== ''),
+        start,
+        end,
+      };
+    });
+
+// formatExclusions formats the maintenance windows as ISO 8601 intervals separated by semicolons.
+const formatExclusions = (exclusions?: TimeWindow[]): string =>
+  (exclusions || []).map((w) => `${w.from}/${w.to}`).join('; ');
+
+const parseExclusions = (value: string): TimeWindow[] =>
+  value
+    .split(';')
+    .map((entry) => entry.trim())
+    .filter((entry) => entry !== '')
+    .map((entry) => {
+      const [from = '', to = ''] = entry.split('/').map((t) => t.trim());
+
+      return { from, to };
+    });
+
 type Props = QueryEditorProps<DataSource, WMResultsQuery, WebMonitoringDataSourceOptions>;
 
 interface Istate {
@@ -64,7 +152,14 @@ export class QueryEditor extends PureComponent<Props, Istate> {
   onMonitorChange = (selectedMonitor: SelectableValue<string>) => {
     const { query, onRunQuery, onChange } = this.props;
     if (!selectedMonitor) {
-      return; // ignore delete?
+      // Cleared, the alarms of all monitors or the monitors matching the filters are queried
+      onChange({
+        ...query,
+        queryMonitorId: undefined,
+        queryMonitorDetails: undefined,
+      });
+      onRunQuery();
+      return;
     }
 
     onChange({
@@ -91,6 +186,215 @@ export class QueryEditor extends PureComponent<Props, Istate> {
     }
   };
 
+  onAggregationChange = (selectedAggregation: SelectableValue<AggregationValue>) => {
+    const { query, onRunQuery, onChange } = this.props;
+
+    if (selectedAggregation.value) {
+      onChange({
+        ...query,
+        queryAggregation: selectedAggregation.value,
+      });
+      onRunQuery();
+    }
+  };
+
+  onPerIntervalChange = (event: React.FormEvent<HTMLInputElement>) => {
+    const { query, onRunQuery, onChange } = this.props;
+
+    onChange({
+      ...query,
+      queryPerInterval: event.currentTarget.checked,
+    });
+    onRunQuery();
+  };
+
+  onRawStatusChange = (event: React.FormEvent<HTMLInputElement>) => {
+    const { query, onRunQuery, onChange } = this.props;
+
+    onChange({
+      ...query,
+      queryRawStatus: event.currentTarget.checked,
+    });
+    onRunQuery();
+  };
+
+  onGroupByChange = (selectedGroupBy: SelectableValue<GroupByValue>) => {
+    const { query, onRunQuery, onChange } = this.props;
+
+    if (selectedGroupBy.value) {
+      onChange({
+        ...query,
+        queryGroupBy: selectedGroupBy.value,
+      });
+      onRunQuery();
+    }
+  };
+
+  onLocationsChange = (event: React.ChangeEvent<HTMLInputElement>) => {
+    const { query, onChange } = this.props;
+
+    onChange({
+      ...query,
+      queryLocations: event.target.value
+        .split(',')
+        .map((location) => location.trim())
+        .filter((location) => location !== ''),
+    });
+  };
+
+  onAlarmStatesChange = (selectedStates: Array<SelectableValue<AlarmStateValue>>) => {
+    const { query, onRunQuery, onChange } = this.props;
+
+    onChange({
+      ...query,
+      queryAlarmStates: selectedStates.map((state) => state.value!),
+    });
+    onRunQuery();
+  };
+
+  onMinAlarmDurationChange = (event: React.ChangeEvent<HTMLInputElement>) => {
+    const { query, onChange } = this.props;
+
+    onChange({
+      ...query,
+      queryMinAlarmDuration: parseFloat(event.target.value) || undefined,
+    });
+  };
+
+  onAlarmSortChange = (selectedSort: SelectableValue<AlarmSortValue>) => {
+    const { query, onRunQuery, onChange } = this.props;
+
+    onChange({
+      ...query,
+      queryAlarmSort: selectedSort.value,
+      queryAlarmSortDesc: query.queryAlarmSort ? query.queryAlarmSortDesc : true,
+    });
+    onRunQuery();
+  };
+
+  onAlarmSortDescChange = (event: React.FormEvent<HTMLInputElement>) => {
+    const { query, onRunQuery, onChange } = this.props;
+
+    onChange({
+      ...query,
+      queryAlarmSort: query.queryAlarmSort || 'found',
+      queryAlarmSortDesc: event.currentTarget.checked,
+    });
+    onRunQuery();
+  };
+
+  onAlarmLimitChange = (event: React.ChangeEvent<HTMLInputElement>) => {
+    const { query, onChange } = this.props;
+
+    onChange({
+      ...query,
+      queryAlarmLimit: parseInt(event.target.value, 10) || undefined,
+    });
+  };
+
+  onKeepDeletedMonitorsChange = (event: React.FormEvent<HTMLInputElement>) => {
+    const { query, onRunQuery, onChange } = this.props;
+
+    onChange({
+      ...query,
+      queryKeepDeletedMonitors: event.currentTarget.checked,
+    });
+    onRunQuery();
+  };
+
+  onAlarmTypesChange = (event: React.ChangeEvent<HTMLInputElement>) => {
+    const { query, onChange } = this.props;
+
+    onChange({
+      ...query,
+      queryAlarmTypes: event.target.value
+        .split(',')
+        .map((alarmType) => alarmType.trim())
+        .filter((alarmType) => alarmType !== ''),
+    });
+  };
+
+  onMonitorIDsChange = (event: React.ChangeEvent<HTMLInputElement>) => {
+    const { query, onChange } = this.props;
+
+    onChange({
+      ...query,
+      queryMonitorIDs: event.target.value
+        .split(',')
+        .map((id) => id.trim())
+        .filter((id) => id !== ''),
+    });
+  };
+
+  onMonitorNameRegexChange = (event: React.ChangeEvent<HTMLInputElement>) => {
+    const { query, onChange } = this.props;
+
+    onChange({
+      ...query,
+      queryMonitorNameRegex: event.target.value,
+    });
+  };
+
+  onMonitorTypeChange = (event: React.ChangeEvent<HTMLInputElement>) => {
+    const { query, onChange } = this.props;
+
+    onChange({
+      ...query,
+      queryMonitorType: event.target.value,
+    });
+  };
+
+  onSLATargetChange = (event: React.ChangeEvent<HTMLInputElement>) => {
+    const { query, onChange } = this.props;
+
+    onChange({
+      ...query,
+      querySLA: {
+        ...query.querySLA,
+        target: parseFloat(event.target.value),
+      },
+    });
+  };
+
+  onSLATimezoneChange = (event: React.ChangeEvent<HTMLInputElement>) => {
+    const { query, onChange } = this.props;
+
+    onChange({
+      ...query,
+      querySLA: {
+        ...query.querySLA,
+        timezone: event.target.value,
+      },
+    });
+  };
+
+  // The schedule is parsed once editing is done, parsing on every change would reformat the input while typing
+  onSLABusinessHoursBlur = (event: React.FocusEvent<HTMLInputElement>) => {
+    const { query, onRunQuery, onChange } = this.props;
+
+    onChange({
+      ...query,
+      querySLA: {
+        ...query.querySLA,
+        businessHours: parseBusinessHours(event.target.value),
+      },
+    });
+    onRunQuery();
+  };
+
+  onSLAExclusionsBlur = (event: React.FocusEvent<HTMLInputElement>) => {
+    const { query, onRunQuery, onChange } = this.props;
+
+    onChange({
+      ...query,
+      querySLA: {
+        ...query.querySLA,
+        exclusions: parseExclusions(event.target.value),
+      },
+    });
+    onRunQuery();
+  };
+
   makeWebMonitoringMonitorSelectable = (monitor: WebMonitoringMonitor): SelectableValue<string> => {
     return {
       ...monitor,
@@ -100,27 +404,44 @@ export class QueryEditor extends PureComponent<Props, Istate> {
   };
 
   renderMonitorResultsInputForm = () => {
-    if (this.props.query.queryType !== 'monitorresults') {
+    const { queryType } = this.props.query;
+
+    if (
+      queryType !== 'monitorresults' &&
+      queryType !== 'availability' &&
+      queryType !== 'status' &&
+      queryType !== 'sla' &&
+      queryType !== 'annotations' &&
+      queryType !== 'alarmstatistics' &&
+      queryType !== 'alarmcounts' &&
+      queryType !== 'alarms'
+    ) {
       return;
     }
 
     const monitorValue = this.props.query.queryMonitorDetails
       ? this.makeWebMonitoringMonitorSelectable({
           ...this.props.query.queryMonitorDetails,
-          id: this.props.query.queryMonitorId,
+          id: this.props.query.queryMonitorId || '',
         })
       : '';
 
     return (
       <>
         <div className="gf-form-inline max-width-30">
-          <InlineField label="Monitors" tooltip="Available monitors" grow={true} labelWidth={14}>
+          <InlineField
+            label="Monitors"
+            tooltip="Available monitors, clear the monitor to apply the name regex and type filter to all monitors"
+            grow={true}
+            labelWidth={14}
+          >
             <Select
               options={this.state.monitors}
               value={monitorValue}
               onChange={this.onMonitorChange}
               menuPlacement={'bottom'}
               placeholder="Select one Monitor"
+              isClearable={true}
               width={24}
             />
           </InlineField>
@@ -147,6 +468,240 @@ export class QueryEditor extends PureComponent<Props, Istate> {
             width={25}
           />
         </div>
+        <div className="gf-form max-width-30">
+          <FormField
+            labelWidth={8}
+            value={(this.props.query.queryMonitorIDs || []).join(', ')}
+            label="Monitor IDs"
+            tooltip="Comma separated IDs of further monitors"
+            onChange={this.onMonitorIDsChange}
+            onBlur={this.props.onRunQuery}
+            width={25}
+          />
+        </div>
+        <div className="gf-form max-width-30">
+          <FormField
+            labelWidth={8}
+            value={this.props.query.queryMonitorNameRegex || ''}
+            label="Name Regex"
+            tooltip="Regular expression the monitor names must match, all monitors if no monitor is selected"
+            onChange={this.onMonitorNameRegexChange}
+            onBlur={this.props.onRunQuery}
+            width={25}
+          />
+        </div>
+        <div className="gf-form max-width-30">
+          <FormField
+            labelWidth={8}
+            value={this.props.query.queryMonitorType || ''}
+            label="Type Filter"
+            tooltip="Monitor type the monitors must have {Icmp, Http, Https, PageLoad, Transaction}, all monitors if no monitor is selected"
+            onChange={this.onMonitorTypeChange}
+            onBlur={this.props.onRunQuery}
+            width={25}
+          />
+        </div>
+        {!alarmQueryTypes.includes(queryType) && (
+          <div className="gf-form max-width-30">
+            <FormField
+              labelWidth={8}
+              value={(this.props.query.queryLocations || []).join(', ')}
+              label="Locations"
+              tooltip="Comma separated location IDs, country codes, continents or cities, all locations if empty"
+              onChange={this.onLocationsChange}
+              onBlur={this.props.onRunQuery}
+              width={25}
+            />
+          </div>
+        )}
+        {alarmQueryTypes.includes(queryType) && (
+          <div className="gf-form max-width-30">
+            <FormField
+              labelWidth={8}
+              value={(this.props.query.queryAlarmTypes || []).join(', ')}
+              label="Alarm Types"
+              tooltip="Comma separated alarm types, all alarms of all monitors if empty and no monitor is selected"
+              onChange={this.onAlarmTypesChange}
+              onBlur={this.props.onRunQuery}
+              width={25}
+            />
+          </div>
+        )}
+        {alarmQueryTypes.includes(queryType) && (
+          <>
+            <div className="gf-form-inline max-width-30">
+              <InlineField label="Alarm States" tooltip="Open, acknowledged or resolved, all if empty" labelWidth={14}>
+                <Select
+                  isMulti={true}
+                  options={alarmStateOptions}
+                  value={this.props.query.queryAlarmStates || []}
+                  onChange={this.onAlarmStatesChange}
+                  menuPlacement={'bottom'}
+                  width={24}
+                />
+              </InlineField>
+            </div>
+            <div className="gf-form max-width-30">
+              <FormField
+                labelWidth={8}
+                value={this.props.query.queryMinAlarmDuration ?? ''}
+                label="Min Duration"
+                tooltip="Minimum duration of the alarms in seconds"
+                onChange={this.onMinAlarmDurationChange}
+                onBlur={this.props.onRunQuery}
+                width={25}
+              />
+            </div>
+          </>
+        )}
+        {queryType === 'alarms' && (
+          <>
+            <div className="gf-form-inline max-width-30">
+              <InlineField label="Sort By" tooltip="Sort key of the alarms, most recently found first if empty" labelWidth={14}>
+                <Select
+                  options={alarmSortOptions}
+                  value={this.props.query.queryAlarmSort || 'found'}
+                  onChange={this.onAlarmSortChange}
+                  menuPlacement={'bottom'}
+                  width={24}
+                />
+              </InlineField>
+            </div>
+            <div className="gf-form-inline max-width-30">
+              <InlineField label="Descending" labelWidth={14}>
+                <Switch
+                  value={this.props.query.queryAlarmSort ? this.props.query.queryAlarmSortDesc || false : true}
+                  onChange={this.onAlarmSortDescChange}
+                />
+              </InlineField>
+            </div>
+            <div className="gf-form max-width-30">
+              <FormField
+                labelWidth={8}
+                value={this.props.query.queryAlarmLimit ?? ''}
+                label="Limit"
+                tooltip="Maximum number of alarms, all if empty"
+                onChange={this.onAlarmLimitChange}
+                onBlur={this.props.onRunQuery}
+                width={25}
+              />
+            </div>
+            <div className="gf-form-inline max-width-30">
+              <InlineField
+                label="Deleted Monitors"
+                tooltip="Keep the alarms of deleted monitors with a placeholder name"
+                labelWidth={14}
+              >
+                <Switch
+                  value={this.props.query.queryKeepDeletedMonitors || false}
+                  onChange={this.onKeepDeletedMonitorsChange}
+                />
+              </InlineField>
+            </div>
+          </>
+        )}
+        {(queryType === 'availability' || queryType === 'alarmstatistics') && (
+          <div className="gf-form-inline max-width-30">
+            <InlineField label="Per Interval" tooltip="Values per interval instead of the whole range" labelWidth={14}>
+              <Switch value={this.props.query.queryPerInterval || false} onChange={this.onPerIntervalChange} />
+            </InlineField>
+          </div>
+        )}
+        {queryType === 'status' && (
+          <div className="gf-form-inline max-width-30">
+            <InlineField label="Raw Status" tooltip="API status instead of up, down and degraded" labelWidth={14}>
+              <Switch value={this.props.query.queryRawStatus || false} onChange={this.onRawStatusChange} />
+            </InlineField>
+          </div>
+        )}
+        {queryType === 'sla' && (
+          <>
+            <div className="gf-form max-width-30">
+              <FormField
+                labelWidth={8}
+                value={this.props.query.querySLA?.target ?? ''}
+                label="SLA Target"
+                tooltip="SLA target in percent, 99.9 if empty"
+                placeholder="99.9"
+                onChange={this.onSLATargetChange}
+                onBlur={this.props.onRunQuery}
+                width={25}
+              />
+            </div>
+            <div className="gf-form max-width-30">
+              <FormField
+                labelWidth={8}
+                value={this.props.query.querySLA?.timezone || ''}
+                label="Timezone"
+                tooltip="Timezone of the business hours, UTC if empty"
+                placeholder="Europe/Berlin"
+                onChange={this.onSLATimezoneChange}
+                onBlur={this.props.onRunQuery}
+                width={25}
+              />
+            </div>
+            <div className="gf-form max-width-30">
+              <FormField
+                key={formatBusinessHours(this.props.query.querySLA?.businessHours)}
+                labelWidth={8}
+                defaultValue={formatBusinessHours(this.props.query.querySLA?.businessHours)}
+                label="Business Hours"
+                tooltip="Weekly schedule the SLA applies to, separated by semicolons, 24/7 if empty"
+                placeholder="mon,tue,wed,thu,fri 08:00-18:00"
+                onBlur={this.onSLABusinessHoursBlur}
+                width={25}
+              />
+            </div>
+            <div className="gf-form max-width-30">
+              <FormField
+                key={formatExclusions(this.props.query.querySLA?.exclusions)}
+                labelWidth={8}
+                defaultValue={formatExclusions(this.props.query.querySLA?.exclusions)}
+                label="Maintenance"
+                tooltip="Planned maintenance windows excluded from the SLA, as from/to in RFC 3339 separated by semicolons"
+                placeholder="2021-07-03T22:00:00Z/2021-07-04T02:00:00Z"
+                onBlur={this.onSLAExclusionsBlur}
+                width={25}
+              />
+            </div>
+          </>
+        )}
+        {queryType === 'monitorresults' && (
+          <div className="gf-form-inline max-width-30">
+            <InlineField
+              label="Aggregation"
+              tooltip="Aggregate the response times per interval, to match the panel resolution"
+              grow={true}
+              labelWidth={14}
+            >
+              <Select
+                options={aggregationOptions}
+                value={this.props.query.queryAggregation || 'none'}
+                onChange={this.onAggregationChange}
+                menuPlacement={'bottom'}
+                width={24}
+              />
+            </InlineField>
+          </div>
+        )}
+        {queryType === 'monitorresults' && (
+          <div className="gf-form-inline max-width-30">
+            <InlineField
+              label="Group By"
+              tooltip="Aggregate the response times across the locations of a group, the average if no aggregation is selected"
+              grow={true}
+              labelWidth={14}
+            >
+              <Select
+                options={groupByOptions}
+                value={this.props.query.queryGroupBy || 'none'}
+                onChange={this.onGroupByChange}
+                menuPlacement={'bottom'}
+                width={24}
+              />
+            </InlineField>
+          </div>
+        )}
       </>
     );
   };
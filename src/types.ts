@@ -1,13 +1,64 @@
 import { DataQuery, DataSourceJsonData } from '@grafana/data';
 
 export interface WMResultsQuery extends DataQuery {
-  queryMonitorId: string;
-  queryMonitorDetails: WebMonitoringMonitorWithoutId;
+  queryMonitorId?: string;
+  queryMonitorDetails?: WebMonitoringMonitorWithoutId;
+  queryMonitorIDs?: string[];
+  queryMonitorNameRegex?: string;
+  queryMonitorType?: string;
+  queryLocations?: string[];
+  queryGroupBy?: GroupByValue;
+  queryAlarmTypes?: string[];
+  queryAlarmStates?: AlarmStateValue[];
+  queryMinAlarmDuration?: number;
+  queryAlarmSort?: AlarmSortValue;
+  queryAlarmSortDesc?: boolean;
+  queryAlarmLimit?: number;
+  queryKeepDeletedMonitors?: boolean;
   queryProduct: ProductType;
   queryType: QueryTypeValue;
+  queryAggregation?: AggregationValue;
+  queryPerInterval?: boolean;
+  queryRawStatus?: boolean;
+  querySLA?: SLASettings;
 }
 
-export type QueryTypeValue = 'monitorresults' | 'monitors' | 'alarms';
+export interface SLASettings {
+  target?: number;
+  timezone?: string;
+  businessHours?: BusinessHours[];
+  exclusions?: TimeWindow[];
+}
+
+export interface BusinessHours {
+  days: string[];
+  start: string;
+  end: string;
+}
+
+export interface TimeWindow {
+  from: string;
+  to: string;
+}
+
+export type QueryTypeValue =
+  | 'monitorresults'
+  | 'availability'
+  | 'status'
+  | 'sla'
+  | 'monitors'
+  | 'alarms'
+  | 'annotations'
+  | 'alarmstatistics'
+  | 'alarmcounts';
+
+export type AlarmStateValue = 'open' | 'acknowledged' | 'resolved';
+
+export type AlarmSortValue = 'found' | 'resolved' | 'duration' | 'monitor' | 'type';
+
+export type GroupByValue = 'none' | 'continent' | 'country';
+
+export type AggregationValue = 'none' | 'avg' | 'min' | 'max' | 'median' | 'p95' | 'p99' | 'count';
 
 export type ProductType = 'webmonitoring';
 
@@ -16,6 +67,40 @@ export type ProductType = 'webmonitoring';
  */
 export interface WebMonitoringDataSourceOptions extends DataSourceJsonData {
   path?: string;
+  apiBaseURL?: string;
+  endpoints?: WebMonitoringEndpoints;
+  timeout?: number;
+  dialTimeout?: number;
+  maxIdleConns?: number;
+  proxyURL?: string;
+  tlsAuth?: boolean;
+  tlsAuthWithCACert?: boolean;
+  tlsSkipVerify?: boolean;
+  maxResponseSize?: number;
+  maxPages?: number;
+  maxItems?: number;
+  maxRetries?: number;
+  retryBaseDelay?: number;
+  retryMaxDelay?: number;
+  rateLimit?: number;
+  rateLimitBurst?: number;
+  monitorsCacheTTL?: number;
+  locationsCacheTTL?: number;
+  resultsCacheBucket?: number;
+  resultsCacheMaxResults?: number;
+  maxConcurrentQueries?: number;
+  queryTimeout?: number;
+}
+
+/**
+ * Optional per-endpoint path overrides, relative to the API base URL
+ */
+export interface WebMonitoringEndpoints {
+  ping?: string;
+  locations?: string;
+  monitors?: string;
+  monitorResults?: string;
+  alarms?: string;
 }
 
 /**
@@ -23,6 +108,9 @@ export interface WebMonitoringDataSourceOptions extends DataSourceJsonData {
  */
 export interface MySecureJsonData {
   apiToken: string;
+  tlsCACert?: string;
+  tlsClientCert?: string;
+  tlsClientKey?: string;
 }
 
 export interface WebMonitoringMonitorWithoutId {